@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+	"github.com/willtrojniak/ethersim/ethersim/experiment"
+)
+
+// scenarioFlags are the flags shared by the commands that run a scenario
+type scenarioFlags struct {
+	scenario string
+	ticks    int
+	load     float64
+	protocol string
+	physical string
+	preset   string
+	signal   string
+	subnet   string
+	check    bool
+}
+
+func (f *scenarioFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.scenario, "scenario", "line", "builtin scenario (pair, line, bus, repeated, star, switched, vlan, redundant) or JSON scenario file")
+	fs.IntVar(&f.ticks, "ticks", 0, "override the number of ticks per run")
+	fs.Float64Var(&f.load, "load", -1, "override the probability per tick that a device queues a message")
+	fs.StringVar(&f.protocol, "protocol", "", "override the protocol")
+	fs.StringVar(&f.preset, "preset", "", "override the physical layer, protocol parameters and frame format with a preset (xerox, 10base5)")
+	fs.StringVar(&f.signal, "signalling", "", "override how frames are put on the ether (abstract, manchester)")
+	fs.StringVar(&f.subnet, "subnet", "", "address devices from an IPv4 subnet, such as 10.0.0.0/24, and send the traffic over IPv4 and ARP")
+	fs.StringVar(&f.physical, "physical", "", "report in physical units of a preset layer (xerox, 10base5)")
+	fs.BoolVar(&f.check, "check", false, "check protocol invariants on every tick and fail on violations")
+}
+
+func (f *scenarioFlags) resolve() (experiment.Scenario, error) {
+	sc, err := experiment.LoadScenario(f.scenario)
+	if err != nil {
+		return sc, err
+	}
+	if f.ticks > 0 {
+		sc.Ticks = f.ticks
+	}
+	if f.load >= 0 {
+		sc.Load, sc.OfferedLoad = f.load, 0
+	}
+	sc.Check = sc.Check || f.check
+	if f.protocol != "" {
+		if sc.Protocol, err = ethersim.ParseProtocol(f.protocol); err != nil {
+			return sc, err
+		}
+	}
+	if f.preset != "" {
+		p, err := ethersim.LookupPreset(f.preset)
+		if err != nil {
+			return sc, err
+		}
+		sc.Physical, sc.Config, sc.Format = p.Physical, p.Config, p.Format
+	}
+	if f.signal != "" {
+		if sc.Signalling, err = ethersim.ParseSignalling(f.signal); err != nil {
+			return sc, err
+		}
+	}
+	if f.subnet != "" {
+		sc.Subnet = f.subnet
+	}
+	if f.physical != "" {
+		if sc.Physical, err = ethersim.PhysicalPreset(f.physical); err != nil {
+			return sc, err
+		}
+	}
+	warnings, err := sc.Validate()
+	if err != nil {
+		return sc, err
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: scenario %v: %v\n", sc.Name, w)
+	}
+	return sc, nil
+}
+
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var sf scenarioFlags
+	sf.register(fs)
+	runs := fs.Int("runs", 30, "number of replications")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of replications run in parallel")
+	seed := fs.Uint64("seed", 1, "seed of the first replication")
+	fs.Parse(args)
+
+	sc, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	b, err := experiment.RunBatch(sc, *runs, *workers, *seed)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("scenario %v: %v runs of %v ticks, %v\n", sc.Name, *runs, sc.Ticks, sc.Protocol)
+	metrics := []struct {
+		name string
+		s    experiment.Summary
+	}{
+		{"efficiency", b.Efficiency},
+		{"throughput", b.Throughput},
+		{"delay", b.Delay},
+		{"collisions", b.Collisions},
+	}
+	if b.Late.Mean > 0 {
+		metrics = append(metrics, struct {
+			name string
+			s    experiment.Summary
+		}{"late collisions", b.Late})
+	}
+	if b.Reflections.Mean > 0 {
+		metrics = append(metrics, struct {
+			name string
+			s    experiment.Summary
+		}{"reflections", b.Reflections})
+	}
+	if b.CodeViolations.Mean > 0 || b.ChecksumErrors.Mean > 0 {
+		metrics = append(metrics, []struct {
+			name string
+			s    experiment.Summary
+		}{
+			{"code violations", b.CodeViolations},
+			{"checksum errors", b.ChecksumErrors},
+		}...)
+	}
+	if b.ARP.Mean > 0 {
+		metrics = append(metrics, []struct {
+			name string
+			s    experiment.Summary
+		}{
+			{"arp packets", b.ARP},
+			{"unreachable", b.Unreachable},
+		}...)
+	}
+	if len(b.Replications) > 0 && b.Replications[0].Stats.Physical.Enabled() {
+		p := b.Replications[0].Stats.Physical
+		fmt.Printf("%.2f Mb/s, %.4g us per tick, %.4g m per stage, %.0f bit frames\n",
+			p.BitRate/1e6, p.Micros(1), p.StageLength(), b.Replications[0].Stats.FrameBits())
+		metrics = append(metrics, []struct {
+			name string
+			s    experiment.Summary
+		}{
+			{"delay (us)", b.DelayMicros},
+			{"throughput (b/s)", b.BitThroughput},
+		}...)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "metric\tmean\tvariance\t95%% CI\n")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "%v\t%.4f\t%.4g\t[%.4f, %.4f]\n", m.name, m.s.Mean, m.s.Variance, m.s.Mean-m.s.CI, m.s.Mean+m.s.CI)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	slot := b.Slot
+	fmt.Printf("\nslot time: round trip of %v ticks needs a slot of at least %v ticks, slot is %v, frames last %v",
+		slot.RoundTrip, slot.MinSlotTicks(), slot.SlotTicks, slot.FrameTicks)
+	if slot.Physical.Enabled() {
+		fmt.Printf(" (%.4g us slot, %.0f bit minimum frame)", slot.SlotMicros(), slot.MinFrameBits())
+	}
+	if slot.LateCollisions() {
+		fmt.Printf(", late collisions possible")
+	}
+	if !slot.Sufficient() {
+		fmt.Printf(", frames %v ticks too short", -slot.Margin())
+	}
+	fmt.Println()
+
+	m := b.Model
+	fmt.Printf("Metcalfe-Boggs model: Q=%v stations, P/C=%v ticks, T=%v ticks\n", m.Stations, m.FrameTicks, m.SlotTicks)
+	fmt.Printf("predicted efficiency %.4f, simulated %.4f, deviation %+.4f\n", b.Predicted, b.Efficiency.Mean, b.Deviation)
+	return nil
+}
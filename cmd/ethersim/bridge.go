@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+func runBridge(args []string) error {
+	fs := flag.NewFlagSet("bridge", flag.ExitOnError)
+	var sf scenarioFlags
+	sf.register(fs)
+	device := fs.Int("device", 0, "index of the device the bridge sends and receives through")
+	port := fs.Uint("port", 0, "UDP port of the bridge on the device, a free one if 0")
+	listen := fs.String("listen", ethersim.DefaultBridgeAddr, "host address and UDP port to listen on")
+	echo := fs.Uint("echo", 7, "UDP port the other devices answer datagrams on, none if 0")
+	speed := fs.Float64("speed", 1, "seconds of simulated time per second of wall clock time, where a tick is a microsecond without a physical layer")
+	duration := fs.Duration("duration", 0, "stop after this long, or on interrupt if 0")
+	seed := fs.Uint64("seed", 1, "seed of the run")
+	fs.Parse(args)
+
+	if *port > 0xffff || *echo > 0xffff {
+		return fmt.Errorf("ports must be below 65536")
+	}
+	sc, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	s, err := sc.Build(*seed)
+	if err != nil {
+		return err
+	}
+	if err := s.AssignIPs(defaultSubnet); err != nil {
+		return err
+	}
+	devices := s.Devices()
+	if *device < 0 || *device >= len(devices) {
+		return fmt.Errorf("no device %v out of %v", *device, len(devices))
+	}
+	b, err := ethersim.MakeBridge(devices[*device], uint16(*port), *listen)
+	if err != nil {
+		return err
+	}
+	b.Speed = *speed
+	if ip := b.HostAddr().(*net.UDPAddr).IP; !ip.IsLoopback() {
+		fmt.Fprintf(os.Stderr, "warning: listening on %v, which is reachable from other hosts\n", ip)
+	}
+
+	fmt.Printf("bridging %v on the host to %v in scenario %v, %v\n", b.HostAddr(), b.DeviceAddr(), sc.Name, sc.Protocol)
+	for i, d := range devices {
+		if i == *device {
+			continue
+		}
+		if *echo == 0 {
+			fmt.Printf("  D%v %v\n", d.Id(), d.IP().Addr())
+			continue
+		}
+		conn, err := d.ListenPacket(uint16(*echo))
+		if err != nil {
+			return err
+		}
+		go serveEcho(conn)
+		fmt.Printf("  D%v echoes on %v\n", d.Id(), conn.LocalAddr())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	start, virtual := time.Now(), s.Now()
+	if err := b.Run(ctx); err != nil {
+		return err
+	}
+
+	stats := b.Stats()
+	elapsed := time.Since(start)
+	achieved := s.Now().Sub(virtual).Seconds() / elapsed.Seconds()
+	fmt.Printf("\nran %v ticks in %v, at a speed of %.3f\n", s.Ticks(), elapsed.Round(time.Millisecond), achieved)
+	if achieved < 0.9**speed {
+		fmt.Printf("the simulation fell behind the wall clock, lower -speed to keep pace\n")
+	}
+	fmt.Printf("%v datagrams to the device, %v from it, %v malformed, %v with no host to go to\n",
+		stats.ToDevice, stats.FromDevice, stats.Malformed, stats.Unclaimed)
+	return nil
+}
+
+// serveEcho answers every datagram with a copy until the connection closes
+func serveEcho(conn *ethersim.PacketConn) {
+	buf := make([]byte, ethersim.MaxDatagramBytes)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(buf[:n], from)
+	}
+}
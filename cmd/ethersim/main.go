@@ -0,0 +1,45 @@
+// Command ethersim runs simulations without the graphical interface
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name string
+	desc string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"batch", "run independent replications of a scenario", runBatch},
+	{"sweep", "run a scenario over a grid of parameter values", runSweep},
+	{"ping", "ping one device of a scenario from another and report round trip times", runPing},
+	{"transfer", "send segments reliably between two devices of a scenario and report goodput", runTransfer},
+	{"bridge", "relay datagrams between a host UDP socket and a device of a scenario in real time", runBridge},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ethersim <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9v %v\n", c.name, c.desc)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "ethersim %v: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// defaultSubnet addresses the devices of scenarios that do not set a subnet
+var defaultSubnet = netip.MustParsePrefix("10.0.0.0/24")
+
+func runPing(args []string) error {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	var sf scenarioFlags
+	sf.register(fs)
+	from := fs.Int("from", 0, "index of the device that pings")
+	to := fs.Int("to", 1, "index of the device pinged")
+	count := fs.Int("c", 10, "number of echo requests")
+	interval := fs.Int("i", 0, "ticks between echo requests, 10 frame times if 0")
+	seed := fs.Uint64("seed", 1, "seed of the run")
+	fs.Parse(args)
+
+	sc, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	s, err := sc.Build(*seed)
+	if err != nil {
+		return err
+	}
+	if err := s.AssignIPs(defaultSubnet); err != nil {
+		return err
+	}
+	devices := s.Devices()
+	if *from < 0 || *from >= len(devices) || *to < 0 || *to >= len(devices) || *from == *to {
+		return fmt.Errorf("need two different devices out of %v", len(devices))
+	}
+	if *interval <= 0 {
+		*interval = 10 * s.Config().FrameTicks
+	}
+	src, dst := devices[*from], devices[*to]
+	p, err := ethersim.MakePing(src, dst.IP().Addr(), *count, *interval)
+	if err != nil {
+		return err
+	}
+
+	physical := s.Physical()
+	s.SetDevicePingReplyCb(func(id int, from netip.Addr, seq int, rtt int) {
+		fmt.Printf("reply from %v: seq=%v time=%v ticks", from, seq, rtt)
+		if physical.Enabled() {
+			fmt.Printf(" (%.1f us)", physical.Micros(float64(rtt)))
+		}
+		fmt.Println()
+	})
+	fmt.Printf("PING %v from %v in scenario %v, %v\n", dst.IP().Addr(), src.IP().Addr(), sc.Name, sc.Protocol)
+	for !p.Done() && s.Ticks() < sc.Ticks {
+		s.Tick()
+	}
+
+	stats := p.Stats()
+	fmt.Printf("\n--- %v ping statistics ---\n%v\n", dst.IP().Addr(), stats)
+	if stats.Received > 0 && physical.Enabled() {
+		fmt.Printf("rtt min/avg/max/jitter = %.1f/%.1f/%.1f/%.1f us\n",
+			physical.Micros(float64(stats.Min)), physical.Micros(stats.Avg), physical.Micros(float64(stats.Max)), physical.Micros(stats.Jitter))
+	}
+	if !p.Done() {
+		fmt.Printf("stopped after %v ticks with requests outstanding\n", sc.Ticks)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/willtrojniak/ethersim/ethersim/experiment"
+)
+
+// paramFlags collects repeated -param flags
+type paramFlags []experiment.Param
+
+func (p *paramFlags) String() string { return fmt.Sprint(*p) }
+func (p *paramFlags) Set(s string) error {
+	param, err := experiment.ParseParam(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	var sf scenarioFlags
+	sf.register(fs)
+	var params paramFlags
+	fs.Var(&params, "param", "swept parameter as name=start:stop:step or name=v1,v2 (repeatable), one of "+strings.Join(experiment.Params, ", "))
+	runs := fs.Int("runs", 5, "number of replications per point")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of replications run in parallel")
+	seed := fs.Uint64("seed", 1, "seed of the first replication of every point")
+	format := fs.String("format", "csv", "output format, csv or json")
+	out := fs.String("o", "-", "output file")
+	svg := fs.String("svg", "", "also plot throughput against offered load to this SVG file")
+	fs.Parse(args)
+
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	sc, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	sw, err := experiment.RunSweep(sc, params, *runs, *workers, *seed)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		err = sw.WriteJSON(w)
+	} else {
+		err = sw.WriteCSV(w)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *svg != "" {
+		f, err := os.Create(*svg)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return sw.WriteSVG(f)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+func runTransfer(args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ExitOnError)
+	var sf scenarioFlags
+	sf.register(fs)
+	from := fs.Int("from", 0, "index of the device that sends")
+	to := fs.Int("to", 1, "index of the device that receives")
+	count := fs.Int("n", 100, "number of segments to send")
+	size := fs.Int("size", 64, "bytes of data per segment")
+	arqName := fs.String("arq", "go-back-n", "how lost segments are sent again (go-back-n, selective-repeat)")
+	window := fs.Int("window", 8, "segments that may go unacknowledged at once")
+	seed := fs.Uint64("seed", 1, "seed of the run")
+	fs.Parse(args)
+
+	arq, err := ethersim.ParseARQ(*arqName)
+	if err != nil {
+		return err
+	}
+	sc, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	s, err := sc.Build(*seed)
+	if err != nil {
+		return err
+	}
+	if err := s.AssignIPs(defaultSubnet); err != nil {
+		return err
+	}
+	devices := s.Devices()
+	if *from < 0 || *from >= len(devices) || *to < 0 || *to >= len(devices) || *from == *to {
+		return fmt.Errorf("need two different devices out of %v", len(devices))
+	}
+	src, dst := devices[*from], devices[*to]
+	c, err := ethersim.MakeConnection(src, dst.IP().Addr(), arq, *window)
+	if err != nil {
+		return err
+	}
+	for i := range *count {
+		data := make([]byte, *size)
+		copy(data, fmt.Sprintf("segment %v", i))
+		if err := c.Send(data); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("TRANSFER %v segments of %v bytes to %v from %v in scenario %v, %v, %v with a window of %v\n",
+		*count, *size, dst.IP().Addr(), src.IP().Addr(), sc.Name, sc.Protocol, arq, *window)
+	for !c.Done() && s.Ticks() < sc.Ticks {
+		s.Tick()
+	}
+
+	stats := c.Stats()
+	fmt.Printf("delivered %v/%v segments (%.1f%%) in %v ticks\n", stats.Delivered, stats.Segments, 100*stats.Delivery(), stats.Ticks)
+	fmt.Printf("sent %v segments, %v retransmissions (%.1f%%), %v timeouts\n", stats.Sent, stats.Retransmissions, 100*stats.RetransmissionRate(), stats.Timeouts)
+	fmt.Printf("goodput %.3f bytes/tick", stats.Goodput())
+	if physical := s.Physical(); physical.Enabled() {
+		fmt.Printf(" (%.3f Mbit/s)", 8*stats.Goodput()/physical.TickDuration/1e6)
+	}
+	fmt.Println()
+	if !c.Done() {
+		fmt.Printf("stopped after %v ticks with segments outstanding\n", sc.Ticks)
+	}
+	return nil
+}
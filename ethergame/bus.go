@@ -0,0 +1,124 @@
+package ethergame
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+const busStagePixels = 12
+
+// Bus draws a bus segment as a straight cable with its transceivers hanging
+// off the taps
+type Bus struct {
+	game *Game
+	bus  *ethersim.BusSegment
+	pos  Vec2[int] // Start of the cable
+	c    color.Color
+}
+
+func (g *Game) MakeBus(s *ethersim.Simulation, length int, x int, y int) *Bus {
+	b := &Bus{
+		game: g,
+		bus:  ethersim.MakeBusSegment(s, length),
+		pos:  Vec2[int]{x, y},
+		c:    ColorDark,
+	}
+	g.buses = append(g.buses, b)
+	g.objs = append(g.objs, b)
+	return b
+}
+
+// CreateTap creates a transceiver tapped onto the cable at pos, or returns nil
+func (b *Bus) CreateTap(pos int) *Node {
+	simNode := b.bus.CreateTap(pos)
+	if simNode == nil {
+		return nil
+	}
+	n := b.game.makeNode(simNode)
+	n.bus = b
+	tap := b.tapPoint(float32(pos))
+	n.MoveTo(tap.X, tap.Y-40)
+	return n
+}
+
+// nextFreeTap returns the first free position at least gap stages past pos, or -1
+func (b *Bus) nextFreeTap(pos int, gap int) int {
+	taken := make(map[int]bool)
+	for _, n := range b.bus.Taps() {
+		taken[b.bus.Position(n)] = true
+	}
+	for p := pos + gap; p <= b.bus.Length(); p++ {
+		if !taken[p] {
+			return p
+		}
+	}
+	return -1
+}
+
+// toggleTermination adds or removes the terminator at the end of the cable nearer pos
+func (b *Bus) toggleTermination(pos int) {
+	end := 0
+	if 2*pos > b.bus.Length() {
+		end = 1
+	}
+	b.bus.SetTerminated(end, !b.bus.Terminated(end))
+}
+
+func (b *Bus) tapPoint(pos float32) Vec2[int] {
+	return Vec2[int]{X: b.pos.X + int(pos*busStagePixels), Y: b.pos.Y}
+}
+
+func (b *Bus) Update() {}
+
+func (b *Bus) Draw(img *ebiten.Image, prog float32) {
+	if b.bus.IsResetting() {
+		b.c = ColorOrange
+	} else {
+		b.c = ColorDark
+	}
+
+	start := b.tapPoint(0)
+	end := b.tapPoint(float32(b.bus.Length()))
+	vector.StrokeLine(img, float32(start.X), float32(start.Y), float32(end.X), float32(end.Y), 6, b.c, true)
+	// Terminators, or a warning where one is missing
+	for i, p := range []Vec2[int]{start, end} {
+		if b.bus.Terminated(i) {
+			vector.StrokeLine(img, float32(p.X), float32(p.Y-8), float32(p.X), float32(p.Y+8), 4, b.c, true)
+		} else {
+			vector.DrawFilledCircle(img, float32(p.X), float32(p.Y), 6, ColorSalmon, true)
+		}
+	}
+
+	for _, n := range b.game.nodes {
+		pos := b.bus.Position(n.NetworkNode)
+		if pos < 0 {
+			continue
+		}
+		tap := b.tapPoint(float32(pos))
+		vector.StrokeLine(img, float32(tap.X), float32(tap.Y), float32(n.Pos().X), float32(n.Pos().Y), 2, ColorDark, true)
+		vector.DrawFilledRect(img, float32(tap.X-3), float32(tap.Y-5), 6, 10, ColorDark, true)
+	}
+
+	for _, msg := range b.bus.Signals() {
+		col := ColorDark
+		if !msg.Msg().Valid() {
+			col = ColorSalmon
+		}
+		if msg.Msg().IsJam() {
+			col = ColorOrange
+		}
+		c := Circle{
+			pos: b.tapPoint(float32(msg.Stage()) + prog*float32(msg.Dir())),
+			c:   col,
+			R:   5,
+		}
+		c.Draw(img, prog)
+	}
+}
+
+func (b *Bus) Pos() Vec2[int]           { return b.pos }
+func (b *Bus) SetColor(col color.Color) { b.c = col }
+func (b *Bus) OnEvent(msg Event) bool   { return false }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/ebitenui/ebitenui/widget"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/willtrojniak/ethersim/ethersim"
 )
 
@@ -29,6 +30,9 @@ func (s *Device) Draw(screen *ebiten.Image, prog float32) {
 	}
 
 	s.Circle.Draw(screen, prog)
+	if t := s.VLAN(); t.Tagged() {
+		vector.DrawFilledCircle(screen, float32(s.pos.X), float32(s.pos.Y), 6, vlanColor(t.ID), true)
+	}
 }
 
 func (s *Device) OnEvent(e Event) bool {
@@ -58,15 +62,29 @@ func (s *Device) OnEvent(e Event) bool {
 		}
 		switch e.Key {
 		case ebiten.KeyM:
+			if len(s.game.devices) < 2 {
+				return true
+			}
 			for range s.game.activeWeight {
 				val := fmt.Sprintf("%v", rand.Intn(10))
 				dest := rand.Intn(len(s.game.devices) - 1)
 				if dest == s.Id() {
 					dest++
 				}
-				s.QueueMessage(&ethersim.BaseMsg{V: true, Msg: val, Sender: s.Id(), To: dest})
+				// Devices with addresses talk over IPv4
+				if to := s.game.devices[dest]; s.IP().IsValid() && s.SendIP(to.IP().Addr(), ethersim.IPProtocolExperimental, []byte(val)) == nil {
+					continue
+				}
+				s.QueueMessage(s.game.sim.Message(s.Id(), dest, val))
 			}
 			return true
+		case ebiten.KeyP:
+			s.ping()
+			return true
+		case ebiten.KeyL:
+			s.SetVLAN(ethersim.VLANTag{ID: (s.VLAN().ID + 1) % (len(vlanColors) + 1)})
+			s.game.LogSimEvent(fmt.Sprintf("(D%v) Tagging frames: %v", s.Id(), s.VLAN()))
+			return true
 		}
 	}
 
@@ -74,7 +92,37 @@ func (s *Device) OnEvent(e Event) bool {
 }
 
 func (d *Device) getLabel() string {
-	return fmt.Sprintf("(D%v) | Last Msg: {val: %v, to: %v, from: %v}", d.Id(), d.LastMsg().Value(), d.LastMsg().Dest(), d.LastMsg().From())
+	label := fmt.Sprintf("(D%v) %v | Last Msg: {val: %v, to: %v, from: %v}", d.Id(), d.MAC(), d.LastMsg().Value(), d.LastMsg().Dest(), d.LastMsg().From())
+	if d.VLAN().Tagged() {
+		label += fmt.Sprintf(" | VLAN: %v", d.VLAN().ID)
+	}
+	if d.IP().IsValid() {
+		label += fmt.Sprintf(" | IP: %v | ARP cache: %v", d.IP(), len(d.ARPCache()))
+	}
+	if p := d.Ping(); p != nil {
+		label += fmt.Sprintf(" | Ping %v: %v", p.Dst, p.Stats())
+	}
+	return label
+}
+
+// ping sends four echo requests to a random other device with an address
+func (d *Device) ping() {
+	var peers []*Device
+	for _, o := range d.game.devices {
+		if o != d && o.IP().IsValid() {
+			peers = append(peers, o)
+		}
+	}
+	if !d.IP().IsValid() || len(peers) == 0 {
+		d.game.LogSimEvent(fmt.Sprintf("(D%v) Ping needs devices with IPv4 addresses, press [o]", d.Id()))
+		return
+	}
+	to := peers[rand.Intn(len(peers))]
+	if _, err := ethersim.MakePing(d.NetworkDevice, to.IP().Addr(), 4, 10*d.game.sim.Config().FrameTicks); err != nil {
+		d.game.LogSimEvent(fmt.Sprintf("(D%v) Ping: %v", d.Id(), err))
+		return
+	}
+	d.game.LogSimEvent(fmt.Sprintf("(D%v) Ping %v", d.Id(), to.IP().Addr()))
 }
 func (d *Device) Update() {
 	d.ui.Label = d.getLabel()
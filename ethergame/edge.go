@@ -1,7 +1,10 @@
 package ethergame
 
 import (
+	"fmt"
 	"image/color"
+	"math"
+	"slices"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/vector"
@@ -30,15 +33,24 @@ func (g *Game) makeEdge(n1 Graphic, n2 Graphic, edge *ethersim.NetworkEdge) *Edg
 func (e *Edge) Update() {}
 
 func (e *Edge) Draw(img *ebiten.Image, prog float32) {
+	// Ports the spanning tree keeps from forwarding, and the edge faded while
+	// any of its ends is blocked
+	states := [2]ethersim.PortState{}
+	for i, n := range []Graphic{e.n1, e.n2} {
+		if s, ok := n.(*Switch); ok {
+			if p := s.Port(e.edge); p >= 0 {
+				states[i] = s.PortState(p)
+			}
+		}
+	}
 	if e.edge.IsResetting() {
 		e.c = ColorOrange
+	} else if states[0] == ethersim.PortBlocking || states[1] == ethersim.PortBlocking {
+		e.c = ColorFadedNavy
 	} else {
 		e.c = ColorDark
 	}
 
-	vector.StrokeLine(img, float32(e.n1.Pos().X), float32(e.n1.Pos().Y),
-		float32(e.n2.Pos().X), float32(e.n2.Pos().Y), 4, e.c, true)
-
 	x1 := e.n1.Pos().X
 	y1 := e.n1.Pos().Y
 	x2 := e.n2.Pos().X
@@ -46,9 +58,26 @@ func (e *Edge) Draw(img *ebiten.Image, prog float32) {
 	dx := float32(x2 - x1)
 	dy := float32(y2 - y1)
 
+	// Full-duplex edges between the network's own components are drawn with a
+	// lane for each direction
+	var lane Vec2[float32]
+	if _, ok := e.n2.(*Device); !ok && e.edge.Duplex() {
+		if l := float32(math.Hypot(float64(dx), float64(dy))); l > 0 {
+			lane = Vec2[float32]{X: -dy / l * 4, Y: dx / l * 4}
+		}
+	}
+	if lane.X == 0 && lane.Y == 0 {
+		vector.StrokeLine(img, float32(x1), float32(y1), float32(x2), float32(y2), 4, e.c, true)
+	} else {
+		for _, side := range []float32{1, -1} {
+			vector.StrokeLine(img, float32(x1)+side*lane.X, float32(y1)+side*lane.Y,
+				float32(x2)+side*lane.X, float32(y2)+side*lane.Y, 2, e.c, true)
+		}
+	}
+
 	w := 1.0 / float32(e.edge.Weight()) * prog
 
-	if prog > 0.5 {
+	if prog > 0.5 && !e.edge.Duplex() {
 		dirs := make(map[int]int)
 		for _, msg := range e.edge.Messages() {
 			if v, ok := dirs[msg.Stage()]; !ok {
@@ -69,6 +98,49 @@ func (e *Edge) Draw(img *ebiten.Image, prog float32) {
 		}
 	}
 
+	// Access ports of switches
+	for i, n := range []Graphic{e.n1, e.n2} {
+		s, ok := n.(*Switch)
+		if !ok {
+			continue
+		}
+		if c := s.PortVLAN(s.Port(e.edge)); c.Mode == ethersim.PortAccess {
+			t := float32(0.2)
+			if i == 1 {
+				t = 0.8
+			}
+			vector.DrawFilledRect(img, float32(x1)+t*dx-4, float32(y1)+t*dy-4, 8, 8, vlanColor(c.VLAN), true)
+		}
+	}
+
+	// Switch ports that are not forwarding
+	for i, st := range states {
+		if st == ethersim.PortForwarding {
+			continue
+		}
+		t := float32(0.3)
+		if i == 1 {
+			t = 0.7
+		}
+		c := ColorYellow
+		if st == ethersim.PortBlocking {
+			c = ColorMaroon
+		}
+		vector.DrawFilledCircle(img, float32(x1)+t*dx, float32(y1)+t*dy, 6, c, true)
+	}
+
+	// Unterminated ends
+	for i, n := range []Graphic{e.n1, e.n2} {
+		if e.edge.Terminated(simNetwork(n)) {
+			continue
+		}
+		t := float32(0.15)
+		if i == 1 {
+			t = 0.85
+		}
+		vector.DrawFilledCircle(img, float32(x1)+t*dx, float32(y1)+t*dy, 5, ColorSalmon, true)
+	}
+
 	for _, msg := range e.edge.Messages() {
 		tickprog := float32(msg.Stage()) / float32(e.edge.Weight())
 		totalprog := tickprog + w*float32(msg.Dir())
@@ -81,10 +153,27 @@ func (e *Edge) Draw(img *ebiten.Image, prog float32) {
 			col = ColorOrange
 		}
 
+		side := float32(msg.Dir())
+		// Signals are drawn as the levels they put on their stage
+		if sig, ok := msg.Msg().(*ethersim.Signal); ok && len(sig.Levels) > 0 {
+			if col == ColorDark {
+				col = ColorNavy
+			}
+			start := Vec2[float32]{X: float32(x1) + totalprog*dx + side*lane.X, Y: float32(y1) + totalprog*dy + side*lane.Y}
+			wave := SquareWave{
+				startPos:  start,
+				endPos:    Vec2[float32]{X: start.X - side*dx/float32(e.edge.Weight()), Y: start.Y - side*dy/float32(e.edge.Weight())},
+				levels:    sig.Levels,
+				amplitude: 6,
+				c:         col,
+			}
+			wave.Draw(img, prog)
+			continue
+		}
 		c := Circle{
 			pos: Vec2[int]{
-				X: x1 + int(totalprog*dx),
-				Y: y1 + int(totalprog*dy),
+				X: x1 + int(totalprog*dx+side*lane.X),
+				Y: y1 + int(totalprog*dy+side*lane.Y),
 			},
 			c: col,
 			R: 6,
@@ -106,6 +195,22 @@ func (e *Edge) Draw(img *ebiten.Image, prog float32) {
 	}
 
 }
+
+// simNetwork returns the simulated component drawn by g
+func simNetwork(g Graphic) ethersim.Network {
+	switch g := g.(type) {
+	case *Node:
+		return g.NetworkNode
+	case *Device:
+		return g.NetworkDevice
+	case *Repeater:
+		return g.Repeater
+	case *Switch:
+		return g.Switch
+	}
+	return nil
+}
+
 func (e *Edge) Pos() Vec2[int] {
 	p := Vec2[int]{}
 	p.X = (e.n1.Pos().X + e.n2.Pos().X) / 2
@@ -115,3 +220,56 @@ func (e *Edge) Pos() Vec2[int] {
 
 func (e *Edge) SetColor(col color.Color) { e.c = col }
 func (e *Edge) OnEvent(msg Event) bool   { return false }
+
+// link joins the component to the one [k] was last pressed on, which may close
+// a loop. The edge is full duplex when either end is a switch.
+func (g *Game) link(n Graphic) {
+	if g.linkFrom == nil || g.linkFrom == n {
+		g.linkFrom = n
+		g.LogSimEvent("Select another component and press [k] to link")
+		return
+	}
+	from := g.linkFrom
+	g.linkFrom = nil
+	simEdge, err := g.sim.Connect(simNetwork(from), simNetwork(n), g.activeWeight)
+	if err != nil {
+		g.LogSimEvent(fmt.Sprintf("Cannot link: %v", err))
+		return
+	}
+	_, ok1 := from.(*Switch)
+	_, ok2 := n.(*Switch)
+	simEdge.SetDuplex(ok1 || ok2)
+	g.makeEdge(from, n, simEdge)
+	g.LogSimEvent(fmt.Sprintf("(E%v) Linked", simEdge.Id()))
+}
+
+// removeEdge cuts the edge nearest to (x, y)
+func (g *Game) removeEdge(x, y int) {
+	var nearest *Edge
+	best := math.Inf(1)
+	for _, e := range g.edges {
+		if d := distToSegment(x, y, e.n1.Pos(), e.n2.Pos()); d < best {
+			nearest, best = e, d
+		}
+	}
+	if nearest == nil {
+		return
+	}
+	if err := g.sim.RemoveEdge(nearest.edge); err != nil {
+		g.LogSimEvent(fmt.Sprintf("Cannot remove: %v", err))
+		return
+	}
+	g.edges = slices.DeleteFunc(g.edges, func(e *Edge) bool { return e == nearest })
+	g.objs = slices.DeleteFunc(g.objs, func(o GameObject) bool { return o == GameObject(nearest) })
+	g.LogSimEvent(fmt.Sprintf("(E%v) Removed", nearest.edge.Id()))
+}
+
+func distToSegment(x, y int, a, b Vec2[int]) float64 {
+	px, py := float64(x-a.X), float64(y-a.Y)
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = max(0, min(1, (px*dx+py*dy)/l))
+	}
+	return math.Hypot(px-t*dx, py-t*dy)
+}
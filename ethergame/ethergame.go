@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image/color"
 	"log"
+	"net/netip"
 	"time"
 
 	"github.com/ebitenui/ebitenui"
@@ -28,6 +29,9 @@ type Game struct {
 	objs            []GameObject
 	nodes           []*Node
 	edges           []*Edge
+	buses           []*Bus
+	repeaters       []*Repeater
+	switches        []*Switch
 	devices         []*Device
 	sim             *ethersim.Simulation
 	justPressedKeys []ebiten.Key
@@ -35,6 +39,8 @@ type Game struct {
 	paused          bool
 	prog            float32
 	activeWeight    int
+	physicalLayer   int
+	linkFrom        Graphic
 	ui              *ebitenui.UI
 	sliderLabel     *widget.Text
 	logEntries      *widget.List
@@ -51,6 +57,9 @@ type LogEntry struct {
 var logId = 0
 
 func (g *Game) LogSimEvent(eventDesc string) {
+	if p := g.sim.Physical(); p.Enabled() {
+		eventDesc = fmt.Sprintf("[%.1f us] %v", p.Micros(float64(g.sim.Ticks())), eventDesc)
+	}
 	g.logEntries.AddEntry(LogEntry{Val: eventDesc, Id: logId})
 	logId++
 }
@@ -64,9 +73,39 @@ func (g *Game) onTransceiverEndTransmit(id int, msg ethersim.NetworkMsg) {
 func (g *Game) onTransceiverJam(id int) {
 	g.LogSimEvent(fmt.Sprintf("(T%v) Detected collision. Jamming", id))
 }
+func (g *Game) onTransceiverLateCollision(id int, msg ethersim.NetworkMsg) {
+	g.LogSimEvent(fmt.Sprintf("(T%v) Late collision on Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
+}
+func (g *Game) onTransceiverDropMsg(id int, msg ethersim.NetworkMsg) {
+	g.LogSimEvent(fmt.Sprintf("(T%v) Dropped Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
+}
+func (g *Game) onTransceiverReceiveError(id int, msg ethersim.NetworkMsg) {
+	g.LogSimEvent(fmt.Sprintf("(T%v) Could not decode Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
+}
+func (g *Game) onRepeaterJam(id int) {
+	g.LogSimEvent(fmt.Sprintf("(R%v) Detected collision. Jamming all segments", id))
+}
+func (g *Game) onSwitchDropMsg(id int, msg ethersim.NetworkMsg) {
+	g.LogSimEvent(fmt.Sprintf("(S%v) Dropped Msg{val: %v, to: %v, from: %v, %v}", id, msg.Value(), msg.Dest(), msg.From(), ethersim.VLANOf(msg)))
+}
+func (g *Game) onSwitchPortState(id int, port int, state ethersim.PortState) {
+	g.LogSimEvent(fmt.Sprintf("(S%v) Port %v %v", id, port, state))
+}
+func (g *Game) onDeviceDropMsg(id int, msg ethersim.NetworkMsg) {
+	g.LogSimEvent(fmt.Sprintf("(D%v) Queue full, dropped Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
+}
 func (g *Game) onDeviceReceiveMsg(id int, msg ethersim.NetworkMsg) {
 	g.LogSimEvent(fmt.Sprintf("(D%v) Recvd Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
 }
+func (g *Game) onDeviceSendARP(id int, p *ethersim.ARPPacket) {
+	g.LogSimEvent(fmt.Sprintf("(D%v) %v", id, p))
+}
+func (g *Game) onDeviceUnreachable(id int, p *ethersim.IPv4Packet) {
+	g.LogSimEvent(fmt.Sprintf("(D%v) No ARP reply from %v, dropped packet {val: %s}", id, p.Dst, p.Payload))
+}
+func (g *Game) onDevicePingReply(id int, from netip.Addr, seq int, rtt int) {
+	g.LogSimEvent(fmt.Sprintf("(D%v) Reply from %v: seq=%v time=%v ticks", id, from, seq, rtt))
+}
 func (g *Game) onDeviceQueueMsg(id int, msg ethersim.NetworkMsg) {
 	g.LogSimEvent(fmt.Sprintf("(D%v) Queue Msg{val: %v, to: %v, from: %v}", id, msg.Value(), msg.Dest(), msg.From()))
 }
@@ -92,6 +131,27 @@ func (g *Game) updateActiveWeightLabel() {
 		g.sliderLabel.Label += "Running | "
 	}
 	g.sliderLabel.Label += fmt.Sprintf("Active Weight: %v", g.activeWeight)
+	if p := g.sim.Physical(); p.Enabled() {
+		g.sliderLabel.Label += fmt.Sprintf(" (%.0f m) | %.2f Mb/s | Time: %.1f us", p.Metres(g.activeWeight), p.BitRate/1e6, p.Micros(float64(g.sim.Ticks())))
+	}
+	g.sliderLabel.Label += fmt.Sprintf(" | Protocol: %v", g.sim.Protocol())
+	if g.sim.Protocol() == ethersim.ProtocolCSMACA && g.sim.RTSCTS() {
+		g.sliderLabel.Label += " (RTS/CTS)"
+	}
+	stats := g.sim.Stats()
+	g.sliderLabel.Label += fmt.Sprintf(" | Collisions: %v", stats.Collisions)
+	if stats.LateCollisions > 0 {
+		g.sliderLabel.Label += fmt.Sprintf(" | Late: %v", stats.LateCollisions)
+	}
+	if stats.Reflections > 0 {
+		g.sliderLabel.Label += fmt.Sprintf(" | Reflections: %v", stats.Reflections)
+	}
+	if g.sim.SpanningTree() {
+		g.sliderLabel.Label += " | Spanning Tree"
+	}
+	if g.sim.Signalling() == ethersim.SignalManchester {
+		g.sliderLabel.Label += fmt.Sprintf(" | Manchester (%v) | Code Violations: %v | Checksum Errors: %v", g.sim.FrameFormat(), stats.CodeViolations, stats.ChecksumErrors)
+	}
 }
 
 func (g *Game) OnEvent(event Event) {
@@ -138,10 +198,78 @@ func (g *Game) OnEvent(event Event) {
 		case ebiten.KeyT:
 			g.sim.Tick()
 			return
+		case ebiten.KeyR:
+			g.sim.SetRTSCTS(!g.sim.RTSCTS())
+			return
+		case ebiten.KeyV:
+			warnings := g.sim.ValidateTopology()
+			for _, w := range warnings {
+				g.LogSimEvent(fmt.Sprintf("Warning: %v", w))
+			}
+			if len(warnings) == 0 {
+				g.LogSimEvent("Topology follows the 5-4-3 rule and round trip limit")
+			}
+			return
+		case ebiten.KeyP:
+			g.sim.SetProtocol((g.sim.Protocol() + 1) % (ethersim.ProtocolCSMACA + 1))
+			return
+		case ebiten.KeyC:
+			x, y := ebiten.CursorPosition()
+			nn := g.MakeBus(g.sim, 10*g.activeWeight, x, y).CreateTap(0)
+			nn.clicked = true
+			nn.selected = true
+			return
+		case ebiten.KeyU:
+			g.cyclePhysical()
+			return
+		case ebiten.KeyG:
+			g.sim.SetSpanningTree(!g.sim.SpanningTree())
+			if g.sim.SpanningTree() {
+				g.LogSimEvent("Spanning tree protocol enabled")
+			} else {
+				g.LogSimEvent("Spanning tree protocol disabled")
+			}
+			return
+		case ebiten.KeyH:
+			if g.sim.Signalling() == ethersim.SignalManchester {
+				g.sim.SetSignalling(ethersim.SignalAbstract)
+				g.LogSimEvent("Abstract signalling")
+				return
+			}
+			// Only frames with a wire format can be sent as bits
+			if g.sim.FrameFormat() == ethersim.FormatAbstract {
+				g.sim.SetFrameFormat(ethersim.FormatXerox)
+			}
+			g.sim.SetSignalling(ethersim.SignalManchester)
+			g.LogSimEvent(fmt.Sprintf("Manchester signalling of %v frames", g.sim.FrameFormat()))
+			return
+		case ebiten.KeyO:
+			if err := g.sim.AssignIPs(guiSubnet); err != nil {
+				g.LogSimEvent(fmt.Sprintf("Warning: %v", err))
+			} else {
+				g.LogSimEvent(fmt.Sprintf("Addressed devices from %v", guiSubnet))
+			}
+			return
+		case ebiten.KeyDelete, ebiten.KeyBackspace:
+			x, y := ebiten.CursorPosition()
+			g.removeEdge(x, y)
+			return
 		}
 	}
 }
 
+// guiSubnet is the IPv4 subnet the [o] key addresses devices from
+var guiSubnet = netip.MustParsePrefix("10.0.0.0/24")
+
+// physicalLayers are cycled through by the [u] key, starting from unitless ticks
+var physicalLayers = []string{"", "xerox", "10base5"}
+
+func (g *Game) cyclePhysical() {
+	g.physicalLayer = (g.physicalLayer + 1) % len(physicalLayers)
+	p, _ := ethersim.PhysicalPreset(physicalLayers[g.physicalLayer])
+	g.sim.SetPhysical(p)
+}
+
 func (g *Game) Update() error {
 	g.ui.Update()
 	for _, obj := range g.objs {
@@ -193,10 +321,22 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		edge.Draw(screen, g.prog)
 	}
 
+	for _, bus := range g.buses {
+		bus.Draw(screen, g.prog)
+	}
+
 	for _, node := range g.nodes {
 		node.Draw(screen, g.prog)
 	}
 
+	for _, r := range g.repeaters {
+		r.Draw(screen, g.prog)
+	}
+
+	for _, s := range g.switches {
+		s.Draw(screen, g.prog)
+	}
+
 	for _, dev := range g.devices {
 		dev.Draw(screen, g.prog)
 	}
@@ -294,7 +434,7 @@ func (g *Game) getEbitenUI() *ebitenui.UI {
 	)
 
 	controlsLabel := widget.NewText(widget.TextOpts.Text(
-		"[space]: Pause/Play | [n]: Transceiver | [d]: Device\n[m]: Message | [0-9]: Set Active Weight | [t] Tick",
+		"[space]: Pause/Play | [n]: Transceiver | [d]: Device\n[m]: Message | [0-9]: Set Active Weight | [t] Tick | [p] Protocol | [r] RTS/CTS | [u] Units | [c] Bus | [v] Validate | [g] Spanning Tree | [h] Manchester | [o] IPv4 Addresses | [del] Remove Edge\nSelected transceiver: [b] Babble | [j] Stuck Jam | [i] Ignore Collisions | [s] Silent | [a] Tap Bus | [x] Terminators | [e] Repeater | [w] Switch | [f] Full Duplex | [l] Switch Port VLAN | [k] Link\nSelected device: [m] Message | [p] Ping | [l] VLAN Tag | Selected repeater: [n] Transceiver | [e] Repeater | [k] Link | Selected switch: [n] Transceiver | [w] Switch | [k] Link",
 		face,
 		color.Black,
 	))
@@ -381,6 +521,9 @@ func MakeGame(sim *ethersim.Simulation) *Game {
 		objs:            make([]GameObject, 0),
 		nodes:           make([]*Node, 0),
 		edges:           make([]*Edge, 0),
+		buses:           make([]*Bus, 0),
+		repeaters:       make([]*Repeater, 0),
+		switches:        make([]*Switch, 0),
 		devices:         make([]*Device, 0),
 		sim:             sim,
 		justPressedKeys: make([]ebiten.Key, 0, 10),
@@ -395,8 +538,18 @@ func MakeGame(sim *ethersim.Simulation) *Game {
 	sim.SetTransceiverBeginTransmitCb(g.onTransceiverBeginTransmit)
 	sim.SetTransceiverEndTransmitCb(g.onTransceiverEndTransmit)
 	sim.SetTransceiverJamCb(g.onTransceiverJam)
+	sim.SetTransceiverLateCollisionCb(g.onTransceiverLateCollision)
+	sim.SetTransceiverDropMsgCb(g.onTransceiverDropMsg)
+	sim.SetTransceiverReceiveErrorCb(g.onTransceiverReceiveError)
+	sim.SetRepeaterJamCb(g.onRepeaterJam)
+	sim.SetSwitchDropMsgCb(g.onSwitchDropMsg)
+	sim.SetSwitchPortStateCb(g.onSwitchPortState)
 	sim.SetDeviceReceiveMsgCb(g.onDeviceReceiveMsg)
 	sim.SetDeviceQueueMsgCb(g.onDeviceQueueMsg)
+	sim.SetDeviceDropMsgCb(g.onDeviceDropMsg)
+	sim.SetDeviceSendARPCb(g.onDeviceSendARP)
+	sim.SetDeviceUnreachableCb(g.onDeviceUnreachable)
+	sim.SetDevicePingReplyCb(g.onDevicePingReply)
 
 	return g
 }
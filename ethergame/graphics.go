@@ -164,6 +164,38 @@ func (w *Wave) Draw(screen *ebiten.Image, prog float32) {
 
 }
 
+// SquareWave draws signal levels as a square wave along a line, each level
+// taking an equal share of it and rising amplitude pixels per unit
+type SquareWave struct {
+	startPos  Vec2[float32]
+	endPos    Vec2[float32]
+	levels    []int
+	amplitude float32
+	c         color.Color
+}
+
+func (w *SquareWave) Draw(screen *ebiten.Image, prog float32) {
+	dx := (w.endPos.X - w.startPos.X) / float32(len(w.levels))
+	dy := (w.endPos.Y - w.startPos.Y) / float32(len(w.levels))
+	l := float32(math.Hypot(float64(dx), float64(dy)))
+	if l == 0 {
+		return
+	}
+	// Levels rise to the left of the direction of travel
+	nx, ny := dy/l*w.amplitude, -dx/l*w.amplitude
+
+	x, y := w.startPos.X, w.startPos.Y
+	prev := 0
+	for i, level := range w.levels {
+		if i == 0 || level != prev {
+			vector.StrokeLine(screen, x+float32(prev)*nx, y+float32(prev)*ny, x+float32(level)*nx, y+float32(level)*ny, 2, w.c, true)
+		}
+		vector.StrokeLine(screen, x+float32(level)*nx, y+float32(level)*ny, x+dx+float32(level)*nx, y+dy+float32(level)*ny, 2, w.c, true)
+		x, y = x+dx, y+dy
+		prev = level
+	}
+}
+
 type Progress struct {
 	C *Circle
 	p float32
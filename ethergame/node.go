@@ -16,11 +16,14 @@ type Node struct {
 	clicked  bool
 	selected bool
 	ui       *widget.Text
+	bus      *Bus // Bus segment the transceiver was tapped onto in the GUI, if any
 }
 
 func (n *Node) Draw(screen *ebiten.Image, prog float32) {
 	if n.selected {
 		n.SetColor(ColorTeal)
+	} else if _, ok := n.ActiveFault(); ok {
+		n.SetColor(ColorMaroon)
 	} else if n.IsResetting() {
 		n.SetColor(ColorOrange)
 	} else if n.IsTransmitting() {
@@ -71,6 +74,55 @@ func (n *Node) OnEvent(e Event) bool {
 			d.clicked = true
 			d.selected = true
 			return true
+		case ebiten.KeyA:
+			if n.bus == nil {
+				return false
+			}
+			pos := n.bus.nextFreeTap(n.bus.bus.Position(n.NetworkNode), n.game.activeWeight)
+			if pos < 0 {
+				return false
+			}
+			nn := n.bus.CreateTap(pos)
+			n.selected = false
+			nn.clicked = true
+			nn.selected = true
+			return true
+		case ebiten.KeyE:
+			r := n.CreateRepeater(n.game.activeWeight)
+			n.selected = false
+			r.clicked = true
+			r.selected = true
+			return true
+		case ebiten.KeyW:
+			s := n.CreateSwitch(n.game.activeWeight)
+			n.selected = false
+			s.clicked = true
+			s.selected = true
+			return true
+		case ebiten.KeyF:
+			n.toggleDuplex()
+			return true
+		case ebiten.KeyL:
+			n.cycleAccess()
+			return true
+		case ebiten.KeyX:
+			n.toggleTermination()
+			return true
+		case ebiten.KeyB:
+			n.toggleFault(ethersim.FaultBabble)
+			return true
+		case ebiten.KeyJ:
+			n.toggleFault(ethersim.FaultStuckJam)
+			return true
+		case ebiten.KeyI:
+			n.toggleFault(ethersim.FaultIgnoreCollisions)
+			return true
+		case ebiten.KeyS:
+			n.toggleFault(ethersim.FaultSilent)
+			return true
+		case ebiten.KeyK:
+			n.game.link(n)
+			return true
 		}
 		return false
 	}
@@ -108,8 +160,37 @@ func (n *Node) CreateNode(w int) *Node {
 	n.game.makeEdge(n, nn, simEdge)
 	return nn
 }
+
+// toggleTermination adds or removes the terminators of the cables ending at
+// the transceiver, or of the nearer end of its bus segment
+func (n *Node) toggleTermination() {
+	for _, e := range n.game.edges {
+		if (e.n1 == n || e.n2 == n) && !e.edge.Duplex() {
+			e.edge.SetTerminated(n.NetworkNode, !e.edge.Terminated(n.NetworkNode))
+		}
+	}
+	if n.bus != nil {
+		n.bus.toggleTermination(n.bus.bus.Position(n.NetworkNode))
+	}
+}
+
+// toggleFault starts a fault on the transceiver until it is toggled again
+func (n *Node) toggleFault(k ethersim.FaultKind) {
+	if n.Faulty(k) {
+		n.ClearFault(k)
+		n.game.LogSimEvent(fmt.Sprintf("(T%v) Cleared fault: %v", n.Id(), k))
+		return
+	}
+	n.InjectFault(ethersim.Fault{Kind: k, Start: n.game.sim.Ticks(), End: -1})
+	n.game.LogSimEvent(fmt.Sprintf("(T%v) Injected fault: %v", n.Id(), k))
+}
+
 func (n *Node) getLabel() string {
-	return fmt.Sprintf("(T%v) | Max Timeout: %v | Queued: %v | Sending: %v | To: %v", n.Id(), n.TimeoutRange(), n.NQueued(), n.SendingValue(), n.SendingTo())
+	label := fmt.Sprintf("(T%v) | Max Timeout: %v | Queued: %v | Sending: %v | To: %v", n.Id(), n.TimeoutRange(), n.NQueued(), n.SendingValue(), n.SendingTo())
+	if k, ok := n.ActiveFault(); ok {
+		label += fmt.Sprintf(" | Fault: %v", k)
+	}
+	return label
 }
 
 func (n *Node) createUI() *widget.Text {
@@ -0,0 +1,100 @@
+package ethergame
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// Ticks a repeater created in the GUI takes to regenerate a message
+const repeaterDelay = 2
+
+type Repeater struct {
+	game *Game
+	*ethersim.Repeater
+	Rect
+	clicked  bool
+	selected bool
+}
+
+func (r *Repeater) Draw(screen *ebiten.Image, prog float32) {
+	if r.selected {
+		r.SetColor(ColorTeal)
+	} else if r.IsJamming() {
+		r.SetColor(ColorOrange)
+	} else {
+		r.SetColor(ColorCyan)
+	}
+	r.Rect.Draw(screen, prog)
+}
+
+func (r *Repeater) OnEvent(e Event) bool {
+	switch e := e.(type) {
+	case MouseClickEvent:
+		if r.In(e.X, e.Y) && e.Button == ebiten.MouseButtonLeft {
+			r.clicked = !r.clicked
+			r.selected = !r.selected
+			return false
+		} else {
+			r.selected = false
+		}
+	case MouseMoveEvent:
+		if r.clicked {
+			r.MoveTo(e.X, e.Y)
+			return false
+		}
+	case MouseReleaseEvent:
+		r.clicked = false
+		return false
+	case KeyJustPressedEvent:
+		if !r.selected {
+			return false
+		}
+		switch e.Key {
+		case ebiten.KeyN:
+			simNode, simEdge := r.Repeater.CreateNode(r.game.activeWeight)
+			nn := r.game.makeNode(simNode)
+			r.game.makeEdge(r, nn, simEdge)
+			r.selected = false
+			nn.clicked = true
+			nn.selected = true
+			return true
+		case ebiten.KeyE:
+			simRepeater, simEdge := r.Repeater.CreateRepeater(r.game.activeWeight, repeaterDelay)
+			rr := r.game.makeRepeater(simRepeater)
+			r.game.makeEdge(r, rr, simEdge)
+			r.selected = false
+			rr.clicked = true
+			rr.selected = true
+			return true
+		case ebiten.KeyK:
+			r.game.link(r)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repeater) Update() {}
+
+func (g *Game) makeRepeater(r *ethersim.Repeater) *Repeater {
+	rr := &Repeater{
+		game:     g,
+		Repeater: r,
+		Rect: Rect{
+			pos: Vec2[int]{50, 50},
+			W:   18,
+			H:   18,
+			c:   ColorCyan,
+		},
+	}
+	g.repeaters = append(g.repeaters, rr)
+	g.objs = append(g.objs, rr)
+	return rr
+}
+
+func (n *Node) CreateRepeater(w int) *Repeater {
+	simRepeater, simEdge := n.NetworkNode.CreateRepeater(w, repeaterDelay)
+	r := n.game.makeRepeater(simRepeater)
+	n.game.makeEdge(n, r, simEdge)
+	return r
+}
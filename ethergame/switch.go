@@ -0,0 +1,174 @@
+package ethergame
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/ebitenui/ebitenui/widget"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+type Switch struct {
+	game *Game
+	*ethersim.Switch
+	Rect
+	clicked  bool
+	selected bool
+	ui       *widget.Text
+}
+
+func (s *Switch) Draw(screen *ebiten.Image, prog float32) {
+	if s.selected {
+		s.SetColor(ColorTeal)
+	} else {
+		s.SetColor(ColorNavy)
+	}
+	s.Rect.Draw(screen, prog)
+}
+
+func (s *Switch) OnEvent(e Event) bool {
+	switch e := e.(type) {
+	case MouseClickEvent:
+		if s.In(e.X, e.Y) && e.Button == ebiten.MouseButtonLeft {
+			s.clicked = !s.clicked
+			s.selected = !s.selected
+			return false
+		} else {
+			s.selected = false
+		}
+	case MouseMoveEvent:
+		if s.clicked {
+			s.MoveTo(e.X, e.Y)
+			return false
+		}
+	case MouseReleaseEvent:
+		s.clicked = false
+		return false
+	case KeyJustPressedEvent:
+		if !s.selected {
+			return false
+		}
+		switch e.Key {
+		case ebiten.KeyN:
+			simNode, simEdge := s.Switch.CreateNode(s.game.activeWeight)
+			nn := s.game.makeNode(simNode)
+			s.game.makeEdge(s, nn, simEdge)
+			s.selected = false
+			nn.clicked = true
+			nn.selected = true
+			return true
+		case ebiten.KeyW:
+			simSwitch, simEdge := s.Switch.CreateSwitch(s.game.activeWeight)
+			ss := s.game.makeSwitch(simSwitch)
+			s.game.makeEdge(s, ss, simEdge)
+			s.selected = false
+			ss.clicked = true
+			ss.selected = true
+			return true
+		case ebiten.KeyK:
+			s.game.link(s)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Switch) getLabel() string {
+	queued := make([]string, 0)
+	for _, q := range s.Queued() {
+		queued = append(queued, fmt.Sprint(q))
+	}
+	label := fmt.Sprintf("(S%v) | Port Queues: %v | Learnt: %v", s.Id(), strings.Join(queued, ", "), s.Learnt())
+	if s.game.sim.SpanningTree() {
+		ports := make([]string, 0)
+		for i := range s.Queued() {
+			ports = append(ports, fmt.Sprintf("%v %v", s.PortRole(i), s.PortState(i)))
+		}
+		label += fmt.Sprintf("\n    Root: %v | Cost: %v | Ports: %v", s.Root(), s.RootCost(), strings.Join(ports, ", "))
+	}
+	return label
+}
+
+func (s *Switch) Update() {
+	s.ui.Label = s.getLabel()
+}
+
+func (g *Game) makeSwitch(s *ethersim.Switch) *Switch {
+	ss := &Switch{
+		game:   g,
+		Switch: s,
+		Rect: Rect{
+			pos: Vec2[int]{50, 50},
+			W:   22,
+			H:   22,
+			c:   ColorNavy,
+		},
+	}
+	ss.ui = widget.NewText(widget.TextOpts.Text(ss.getLabel(), face, color.Black))
+	g.transceiverDataContainer.AddChild(ss.ui)
+	g.switches = append(g.switches, ss)
+	g.objs = append(g.objs, ss)
+	return ss
+}
+
+func (n *Node) CreateSwitch(w int) *Switch {
+	simSwitch, simEdge := n.NetworkNode.CreateSwitch(w)
+	s := n.game.makeSwitch(simSwitch)
+	n.game.makeEdge(n, s, simEdge)
+	return s
+}
+
+// toggleDuplex switches the edges of the transceiver between a shared medium
+// and separate channels in each direction
+func (n *Node) toggleDuplex() {
+	duplex := false
+	for _, e := range n.game.edges {
+		if e.n1 == n || e.n2 == n {
+			if _, ok := e.n2.(*Device); !ok && !e.edge.Duplex() {
+				duplex = true
+			}
+		}
+	}
+	for _, e := range n.game.edges {
+		if e.n1 == n || e.n2 == n {
+			if _, ok := e.n2.(*Device); !ok {
+				e.edge.SetDuplex(duplex)
+			}
+		}
+	}
+	if duplex {
+		n.game.LogSimEvent(fmt.Sprintf("(T%v) Edges set to full duplex", n.Id()))
+	} else {
+		n.game.LogSimEvent(fmt.Sprintf("(T%v) Edges set to half duplex", n.Id()))
+	}
+}
+
+// VLANs that can be set up in the GUI, each drawn in its own colour
+var vlanColors = []color.Color{ColorGreen, ColorPurple, ColorYellow}
+
+func vlanColor(vlan int) color.Color { return vlanColors[(vlan-1)%len(vlanColors)] }
+
+// cycleAccess moves the switch port facing the transceiver through being a
+// trunk and an access port of each VLAN
+func (n *Node) cycleAccess() {
+	for _, e := range n.game.edges {
+		s, ok := e.n1.(*Switch)
+		if !ok || e.n2 != n {
+			if s, ok = e.n2.(*Switch); !ok || e.n1 != n {
+				continue
+			}
+		}
+		i := s.Port(e.edge)
+		c := s.PortVLAN(i)
+		if c.Mode == ethersim.PortAccess && c.VLAN >= len(vlanColors) {
+			s.SetTrunk(i, 1)
+		} else if c.Mode == ethersim.PortAccess {
+			s.SetAccess(i, c.VLAN+1)
+		} else {
+			s.SetAccess(i, 1)
+		}
+		n.game.LogSimEvent(fmt.Sprintf("(S%v) Port %v: %v VLAN %v", s.Id(), i, s.PortVLAN(i).Mode, s.PortVLAN(i).VLAN))
+	}
+}
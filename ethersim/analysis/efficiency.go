@@ -0,0 +1,54 @@
+// Package analysis holds closed-form models of the simulated protocols
+package analysis
+
+import (
+	"math"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// Model is the efficiency estimate of Metcalfe and Boggs for Q stations that
+// always have a frame queued, each frame lasting P/C ticks
+type Model struct {
+	Stations   int // Q
+	FrameTicks int // P/C
+	SlotTicks  int // T, the round trip end-to-end propagation delay
+}
+
+// MetcalfeBoggs derives the model from the topology and configuration of a
+// simulation. The slot time is the round trip of the longest path between
+// transceivers.
+func MetcalfeBoggs(s *ethersim.Simulation) Model {
+	return Model{
+		Stations:   len(s.Devices()),
+		FrameTicks: s.Config().FrameTicks,
+		SlotTicks:  2 * s.MaxPropagationDelay(),
+	}
+}
+
+// Acquisition is the probability A = (1-1/Q)^(Q-1) that exactly one station
+// transmits in a slot
+func (m Model) Acquisition() float64 {
+	if m.Stations <= 1 {
+		return 1
+	}
+	q := float64(m.Stations)
+	return math.Pow(1-1/q, q-1)
+}
+
+// Wait is the mean number of slots W = (1-A)/A spent contending before a
+// station acquires the ether
+func (m Model) Wait() float64 {
+	a := m.Acquisition()
+	return (1 - a) / a
+}
+
+// Efficiency is the fraction of time E = (P/C) / (P/C + W*T) the ether
+// carries frames that are sent without a collision
+func (m Model) Efficiency() float64 {
+	p := float64(m.FrameTicks)
+	if p == 0 {
+		return 0
+	}
+	return p / (p + m.Wait()*float64(m.SlotTicks))
+}
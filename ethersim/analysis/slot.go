@@ -0,0 +1,48 @@
+package analysis
+
+import "github.com/willtrojniak/ethersim/ethersim"
+
+// SlotTime compares the slot time a topology needs with the configured slot
+// time and frame length. CSMA/CD detects every collision within the slot
+// time only if the worst-case round trip across the network is shorter than
+// the slot, and every collision at all only if frames last at least a slot.
+type SlotTime struct {
+	RoundTrip  int // Worst-case round trip propagation delay in ticks, the required slot time
+	SlotTicks  int // Configured slot time
+	FrameTicks int // Configured transmission time of a frame
+
+	Physical ethersim.Physical // Physical layer to report in microseconds and bits, if enabled
+}
+
+// SlotTimeOf derives the slot time from the edge weights, bus segments and
+// repeater delays of a simulation
+func SlotTimeOf(s *ethersim.Simulation) SlotTime {
+	return SlotTime{
+		RoundTrip:  s.RoundTripDelay(),
+		SlotTicks:  s.Config().SlotTicks,
+		FrameTicks: s.Config().FrameTicks,
+		Physical:   s.Physical(),
+	}
+}
+
+// MinSlotTicks is the shortest slot time within which every collision is detected
+func (a SlotTime) MinSlotTicks() int { return a.RoundTrip + 1 }
+
+// MinFrameTicks is the shortest frame for which collisions are always
+// detected, one configured slot time or the round trip if that is longer
+func (a SlotTime) MinFrameTicks() int { return max(a.SlotTicks, a.MinSlotTicks()) }
+
+// LateCollisions reports whether collisions may be detected after the slot time
+func (a SlotTime) LateCollisions() bool { return a.SlotTicks < a.MinSlotTicks() }
+
+// Sufficient reports whether frames last long enough to detect every collision
+func (a SlotTime) Sufficient() bool { return a.FrameTicks >= a.MinFrameTicks() }
+
+// Margin is the number of ticks a frame lasts beyond the minimum, negative if too short
+func (a SlotTime) Margin() int { return a.FrameTicks - a.MinFrameTicks() }
+
+// SlotMicros is the required slot time in microseconds
+func (a SlotTime) SlotMicros() float64 { return a.Physical.Micros(float64(a.MinSlotTicks())) }
+
+// MinFrameBits is the size of the shortest frame in bits
+func (a SlotTime) MinFrameBits() float64 { return a.Physical.Bits(float64(a.MinFrameTicks())) }
@@ -0,0 +1,348 @@
+package ethersim
+
+var numSIFSTicks int = 2
+var numControlTicks int = 5
+var minContentionWindow int = 8
+var maxContentionWindow int = 256
+var numRetryLimit int = 7
+
+// Sequence numbers wrap around after this many frames, as the 12-bit
+// sequence number of IEEE 802.11 does
+var numSequenceNumbers int = 4096
+
+const (
+	caContend = iota // Waiting for the medium and counting down the backoff
+	caSendRTS
+	caWaitCTS
+	caSendData
+	caWaitACK
+)
+
+// SequenceControl numbers the data frames of each sender under collision
+// avoidance, so that a receiver whose ACK was lost can tell a retransmission
+// from a new frame
+type SequenceControl struct {
+	Seq   int
+	Retry bool // The frame was sent before
+}
+
+// Sequenced is implemented by data frames that carry a sequence control
+type Sequenced interface {
+	SequenceControl() SequenceControl
+	SetSequenceControl(c SequenceControl)
+}
+
+// sequences holds the sequence number last received from each sender
+type sequences map[int]int
+
+// duplicate reports whether msg is a retransmission of the frame last
+// received from its sender, and otherwise remembers its sequence number
+func (s sequences) duplicate(msg NetworkMsg) bool {
+	m, ok := msg.(Sequenced)
+	if !ok {
+		return false
+	}
+	c := m.SequenceControl()
+	if last, seen := s[msg.From()]; seen && c.Retry && last == c.Seq {
+		return true
+	}
+	s[msg.From()] = c.Seq
+	return false
+}
+
+// seqOf returns the sequence number of msg, or 0 if it carries none
+func seqOf(msg NetworkMsg) int {
+	if m, ok := msg.(Sequenced); ok {
+		return m.SequenceControl().Seq
+	}
+	return 0
+}
+
+// avoidance is the collision avoidance state of a transceiver
+type avoidance struct {
+	state    int
+	backoff  int // Idle ticks left before sending, -1 until drawn
+	cw       int // Contention window in slots
+	idle     int // Consecutive ticks the medium has been idle
+	retries  int
+	sendAt   int // Tick at which the data frame may be sent after a CTS
+	deadline int // Tick at which an awaited CTS or ACK is considered lost
+	nav      int // Tick until which the medium is reserved by others
+
+	tx       NetworkMsg // Control frame currently on the wire
+	txRem    int
+	reply    NetworkMsg // Control frame to send once the SIFS has passed
+	replyAt  int
+	rxBroken bool // Part of the frame being received was corrupted
+
+	seq      int  // Sequence number of the frame at the head of the queue
+	sent     bool // The frame at the head of the queue has been sent before
+	received sequences
+}
+
+func makeAvoidance() avoidance {
+	return avoidance{
+		state:    caContend,
+		backoff:  -1,
+		cw:       minContentionWindow,
+		received: make(sequences),
+	}
+}
+
+// difsTicks is the idle time required before contending for the medium
+func (n *NetworkNode) difsTicks() int { return numSIFSTicks + 2*n.sim.slotTicks() }
+
+// responseTicks is how long a station waits for a CTS or ACK
+func (n *NetworkNode) responseTicks() int {
+	return numSIFSTicks + numControlTicks + 2*n.sim.slotTicks()
+}
+
+func (n *NetworkNode) tickCSMACA() {
+	a := &n.ca
+	t := n.sim.ticks
+
+	if msg := n.receiveFrame(); msg != nil {
+		n.onFrame(msg)
+	}
+
+	// Physical and virtual carrier sense
+	if len(n.incMessages) > 0 || t < a.nav {
+		a.idle = 0
+	} else {
+		a.idle++
+	}
+
+	if (a.state == caWaitCTS || a.state == caWaitACK) && t >= a.deadline {
+		n.retry()
+	}
+
+	if a.tx == nil && !n.transmitting {
+		if a.reply != nil && t >= a.replyAt {
+			a.tx, a.txRem = a.reply, numControlTicks
+			a.reply = nil
+		} else if a.state == caSendData && t >= a.sendAt {
+			n.sendData()
+		} else if a.state == caContend && len(n.outMessages) > 0 {
+			n.contend()
+		}
+	}
+
+	var out NetworkMsg
+	if a.tx != nil {
+		a.txRem--
+		if a.txRem <= 0 {
+			a.tx.SetLast()
+		}
+		out = a.tx.Copy()
+	} else if n.transmitting {
+		// Frames may be retransmitted, so only the copy on the wire is marked last
+		n.transmitRem--
+		out = n.outMessages[0].Copy()
+		if n.transmitRem <= 0 {
+			out.SetLast()
+		}
+		out = n.sim.encode(out, n.sim.config.FrameTicks-1-n.transmitRem)
+	}
+
+	// Without collision detection, transmissions superimpose on what is being forwarded
+	for _, edge := range n.edges {
+		if out != nil {
+			edge.OnMsg(out.Copy(), n)
+		}
+		for _, msg := range n.incMessages {
+			if !edge.connects(msg.from) {
+				edge.OnMsg(msg.m.Copy(), n)
+			}
+		}
+	}
+
+	if a.tx != nil && a.txRem <= 0 {
+		if m, ok := a.tx.(*ControlMsg); ok && m.Kind == ControlRTS {
+			a.state = caWaitCTS
+			a.deadline = t + n.responseTicks()
+		}
+		a.tx = nil
+	} else if n.transmitting && n.transmitRem <= 0 {
+		n.transmitting = false
+		if broadcast(n.outMessages[0]) {
+			n.acknowledged()
+		} else {
+			a.state = caWaitACK
+			a.deadline = t + n.responseTicks()
+		}
+	}
+
+	n.incMessages = n.incMessages[:0]
+}
+
+// contend counts down the backoff while the medium is idle and starts the
+// exchange once it expires
+func (n *NetworkNode) contend() {
+	a := &n.ca
+	if a.backoff < 0 {
+		a.backoff = n.sim.rand.IntN(a.cw) * n.sim.slotTicks()
+	}
+	if a.idle < n.difsTicks() {
+		return
+	}
+	if a.backoff > 0 {
+		a.backoff--
+		return
+	}
+
+	a.backoff = -1
+	if !n.sim.rtsCts || broadcast(n.outMessages[0]) {
+		a.state = caSendData
+		a.sendAt = n.sim.ticks
+		n.sendData()
+		return
+	}
+
+	slot := n.sim.slotTicks()
+	a.state = caSendRTS
+	a.tx, a.txRem = &ControlMsg{
+		V:        true,
+		Kind:     ControlRTS,
+		Sender:   n.deviceId(),
+		To:       n.outMessages[0].Dest(),
+		Duration: 3*numSIFSTicks + 2*numControlTicks + n.sim.config.FrameTicks + 3*slot,
+	}, numControlTicks
+}
+
+// sendData starts sending the frame at the head of the queue, numbered with
+// its sequence number and flagged as a retry if it was sent before
+func (n *NetworkNode) sendData() {
+	a := &n.ca
+	if m, ok := n.outMessages[0].(Sequenced); ok {
+		m.SetSequenceControl(SequenceControl{Seq: a.seq, Retry: a.sent})
+	}
+	a.sent = true
+	n.transmitting = true
+	n.transmitRem = n.sim.config.FrameTicks
+	n.sim.onTransceiverBeginTransmit(n.id, n.outMessages[0])
+}
+
+// retry backs off after a lost CTS or ACK and drops the frame once the retry
+// limit has been reached
+func (n *NetworkNode) retry() {
+	a := &n.ca
+	a.state = caContend
+	a.backoff = -1
+	a.retries++
+	a.cw = min(2*a.cw, maxContentionWindow)
+	if a.retries > numRetryLimit {
+		msg := n.outMessages[0]
+		n.outMessages = n.outMessages[1:]
+		a.retries = 0
+		a.cw = minContentionWindow
+		a.nextSeq()
+		n.sim.onTransceiverDropMsg(n.id, msg)
+	}
+}
+
+// onFrame handles a frame that was received in full
+func (n *NetworkNode) onFrame(msg NetworkMsg) {
+	a := &n.ca
+	t := n.sim.ticks
+	ctrl, isCtrl := msg.(*ControlMsg)
+
+	if !n.forDevice(msg) {
+		if isCtrl {
+			a.nav = max(a.nav, t+ctrl.Duration)
+		}
+		return
+	}
+
+	if !isCtrl {
+		// A retransmission whose ACK was lost is acknowledged again but not
+		// passed on a second time
+		if !a.received.duplicate(msg) {
+			n.deviceEdge.OnMsg(msg.Copy(), n)
+		}
+		// Broadcasts go unacknowledged, as every station would answer at once
+		if broadcast(msg) {
+			return
+		}
+		a.reply = &ControlMsg{V: true, Kind: ControlACK, Sender: n.deviceId(), To: msg.From(), Seq: seqOf(msg)}
+		a.replyAt = t + numSIFSTicks
+		return
+	}
+
+	switch ctrl.Kind {
+	case ControlRTS:
+		a.reply = &ControlMsg{
+			V:        true,
+			Kind:     ControlCTS,
+			Sender:   n.deviceId(),
+			To:       ctrl.Sender,
+			Duration: ctrl.Duration - numSIFSTicks - numControlTicks - n.sim.slotTicks(),
+		}
+		a.replyAt = t + numSIFSTicks
+	case ControlCTS:
+		if a.state == caWaitCTS && ctrl.Sender == n.outMessages[0].Dest() {
+			a.state = caSendData
+			a.sendAt = t + numSIFSTicks
+		}
+	case ControlACK:
+		if a.state == caWaitACK && ctrl.Sender == n.outMessages[0].Dest() && ctrl.Seq == seqOf(n.outMessages[0]) {
+			n.acknowledged()
+		}
+	}
+}
+
+// acknowledged finishes with the frame at the head of the queue
+func (n *NetworkNode) acknowledged() {
+	a := &n.ca
+	a.state = caContend
+	a.retries = 0
+	a.cw = minContentionWindow
+	a.nextSeq()
+	n.sim.onTransceiverEndTransmit(n.id, n.outMessages[0])
+	n.outMessages = n.outMessages[1:]
+}
+
+// nextSeq moves on to the sequence number of the next frame
+func (a *avoidance) nextSeq() {
+	a.seq = (a.seq + 1) % numSequenceNumbers
+	a.sent = false
+}
+
+// receiveFrame returns a frame once its last part has arrived, provided no
+// part of it was corrupted on the way
+func (n *NetworkNode) receiveFrame() NetworkMsg {
+	a := &n.ca
+	if len(n.incMessages) == 0 {
+		a.rxBroken = false
+		return nil
+	}
+
+	msg := n.incMessages[0].m
+	if len(n.incMessages) > 1 || !msg.Valid() || n.transmitting || a.tx != nil {
+		a.rxBroken = true
+	}
+	msg = n.receive(msg)
+	if !msg.IsLast() {
+		return nil
+	}
+
+	broken := a.rxBroken
+	a.rxBroken = false
+	if broken {
+		return nil
+	}
+	return msg
+}
+
+// forDevice reports whether msg is addressed to the device attached to the
+// transceiver, or broadcast to every device
+func (n *NetworkNode) forDevice(msg NetworkMsg) bool {
+	return n.deviceEdge != nil && (msg.Dest() == n.deviceId() || broadcast(msg))
+}
+
+// deviceId returns the id of the device attached to the transceiver, or -1
+func (n *NetworkNode) deviceId() int {
+	if n.deviceEdge == nil {
+		return -1
+	}
+	return n.deviceEdge.n2.Id()
+}
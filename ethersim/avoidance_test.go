@@ -0,0 +1,40 @@
+package ethersim_test
+
+import (
+	"testing"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// TestAvoidanceDuplicates loads a bus long enough for ACKs to collide under
+// CSMA/CA, and checks that the retransmissions they cause are never
+// delivered twice
+func TestAvoidanceDuplicates(t *testing.T) {
+	s := ethersim.MakeSeededSimulation(1)
+	build(t, s, ethersim.BusTopology(6, 20))
+	s.SetProtocol(ethersim.ProtocolCSMACA)
+	ethersim.MakeTraffic(s, 0.01)
+
+	last := make(map[[2]int]int)
+	retries, duplicates := 0, 0
+	s.SetDeviceReceiveMsgCb(func(id int, msg ethersim.NetworkMsg) {
+		c := msg.(ethersim.Sequenced).SequenceControl()
+		if c.Retry {
+			retries++
+		}
+		key := [2]int{id, msg.From()}
+		if seq, ok := last[key]; ok && seq == c.Seq {
+			duplicates++
+		}
+		last[key] = c.Seq
+	})
+	for range 20000 {
+		s.Tick()
+	}
+	if retries == 0 {
+		t.Fatal("no retransmission was received")
+	}
+	if duplicates > 0 {
+		t.Errorf("%v of %v retransmissions received were delivered twice", duplicates, retries)
+	}
+}
@@ -0,0 +1,182 @@
+package ethersim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// DefaultBridgeAddr is the host address a bridge listens on unless told
+// otherwise: loopback only, on a free port
+const DefaultBridgeAddr = "127.0.0.1:0"
+
+// Every datagram through a bridge starts with the IPv4 address and port of
+// the simulated socket it is for or from
+const bridgeHeaderBytes = 6
+
+// Ticks run between checks for the end of a bridge, when the simulation lags
+// behind the wall clock
+const bridgeTickBatch = 1000
+
+// Bridge relays datagrams between a UDP socket on the host and a UDP socket
+// on a simulated device, so that programs outside the simulation can send
+// and receive traffic on the ether. A datagram from the host starts with the
+// IPv4 address and port, in network byte order, of the simulated socket to
+// send the rest to. Datagrams the device receives are passed on to the host
+// address that last sent one to the bridge, after the address and port of
+// their sender in the same form.
+type Bridge struct {
+	sim    *Simulation
+	device *PacketConn
+	host   *net.UDPConn
+	Speed  float64 // Seconds of virtual time run per second of wall clock time
+
+	mu    sync.Mutex
+	peer  *net.UDPAddr // Host address datagrams from the device go to
+	stats BridgeStats
+}
+
+// BridgeStats counts the datagrams a bridge relayed
+type BridgeStats struct {
+	ToDevice   int // Datagrams from the host sent on by the device
+	FromDevice int // Datagrams received by the device and passed on to the host
+	Malformed  int // Datagrams from the host too short for the header or too long for a frame
+	Unclaimed  int // Datagrams received by the device before any host address sent one
+}
+
+// MakeBridge listens on the host at hostAddr, DefaultBridgeAddr if empty, and
+// on the given port of the device, or a free one if port is 0
+func MakeBridge(d *NetworkDevice, port uint16, hostAddr string) (*Bridge, error) {
+	if hostAddr == "" {
+		hostAddr = DefaultBridgeAddr
+	}
+	laddr, err := net.ResolveUDPAddr("udp", hostAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.ListenPacket(port)
+	if err != nil {
+		return nil, err
+	}
+	host, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Bridge{sim: d.sim, device: conn, host: host, Speed: 1}, nil
+}
+
+func (b *Bridge) HostAddr() net.Addr   { return b.host.LocalAddr() }
+func (b *Bridge) DeviceAddr() net.Addr { return b.device.LocalAddr() }
+
+func (b *Bridge) Stats() BridgeStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Run ticks the simulation so that its virtual clock keeps pace with the
+// wall clock, scaled by Speed, and relays datagrams until ctx is done. It
+// then closes both sockets. Nothing else may tick or change the simulation
+// while it runs.
+//
+// A tick lasts a microsecond of virtual time without a physical layer, and a
+// bit time with one, so at Speed 1 the simulation has to run a million ticks
+// or more every second. When it cannot, it runs flat out and its clock falls
+// behind the wall clock; a lower Speed keeps the two in step.
+func (b *Bridge) Run(ctx context.Context) error {
+	if b.Speed <= 0 {
+		return fmt.Errorf("bridge speed must be positive")
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		b.fromHost()
+	}()
+	go func() {
+		defer wg.Done()
+		b.fromDevice()
+	}()
+
+	start, startTick := time.Now(), b.sim.ticks
+	pace := time.NewTicker(time.Millisecond)
+	defer pace.Stop()
+	for ctx.Err() == nil {
+		target := startTick + int(time.Since(start).Seconds()*b.Speed/b.sim.tickSeconds())
+		for i := 0; b.sim.ticks < target && (i%bridgeTickBatch != 0 || ctx.Err() == nil); i++ {
+			b.sim.Tick()
+		}
+		select {
+		case <-ctx.Done():
+		case <-pace.C:
+		}
+	}
+
+	// The device socket is freed on the next tick, which the bridge no longer runs
+	b.host.Close()
+	b.device.Close()
+	wg.Wait()
+	return nil
+}
+
+// fromHost sends the datagrams of the host on from the device
+func (b *Bridge) fromHost() {
+	buf := make([]byte, bridgeHeaderBytes+MaxDatagramBytes+1)
+	for {
+		n, from, err := b.host.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		b.mu.Lock()
+		b.peer = from
+		if n < bridgeHeaderBytes || n > bridgeHeaderBytes+MaxDatagramBytes {
+			b.stats.Malformed++
+			b.mu.Unlock()
+			continue
+		}
+		b.mu.Unlock()
+		to := &Addr{IP: netip.AddrFrom4([4]byte(buf[:4])), Port: binary.BigEndian.Uint16(buf[4:])}
+		if _, err := b.device.WriteTo(buf[bridgeHeaderBytes:n], to); err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.stats.ToDevice++
+		b.mu.Unlock()
+	}
+}
+
+// fromDevice passes the datagrams the device receives on to the host
+func (b *Bridge) fromDevice() {
+	buf := make([]byte, bridgeHeaderBytes+MaxDatagramBytes)
+	for {
+		n, from, err := b.device.ReadFrom(buf[bridgeHeaderBytes:])
+		if err != nil {
+			return
+		}
+		src := from.(*Addr)
+		ip := src.IP.As4()
+		copy(buf, ip[:])
+		binary.BigEndian.PutUint16(buf[4:], src.Port)
+
+		b.mu.Lock()
+		peer := b.peer
+		if peer == nil {
+			b.stats.Unclaimed++
+		} else {
+			b.stats.FromDevice++
+		}
+		b.mu.Unlock()
+		if peer != nil {
+			b.host.WriteToUDP(buf[:bridgeHeaderBytes+n], peer)
+		}
+	}
+}
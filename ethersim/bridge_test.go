@@ -0,0 +1,66 @@
+package ethersim_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// TestBridge sends a datagram from the host through a bridge on loopback to
+// an echo socket on another device, and checks the reply and the counts
+func TestBridge(t *testing.T) {
+	_, a, b := udpPair(t)
+	server, err := b.ListenPacket(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go echo(server)
+	bridge, err := ethersim.MakeBridge(a, 0, ethersim.DefaultBridgeAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := b.IP().Addr().AsSlice()
+	header = binary.BigEndian.AppendUint16(header, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error)
+	go func() { ran <- bridge.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-ran; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	host, err := net.DialUDP("udp", nil, bridge.HostAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	if _, err := host.Write(header[:3]); err != nil {
+		t.Fatal(err)
+	}
+	datagram := append(header, "hello"...)
+	if _, err := host.Write(datagram); err != nil {
+		t.Fatal(err)
+	}
+	host.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := host.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], datagram) {
+		t.Errorf("reply % x, not % x", buf[:n], datagram)
+	}
+
+	want := ethersim.BridgeStats{ToDevice: 1, FromDevice: 1, Malformed: 1}
+	if st := bridge.Stats(); st != want {
+		t.Errorf("stats %+v, not %+v", st, want)
+	}
+}
@@ -0,0 +1,167 @@
+package ethersim
+
+// BusSegment is a single passive coaxial cable with transceivers tapped along
+// it. Signals spread in both directions from the tap they enter at and are
+// absorbed by the terminators at either end, or reflected if one is missing.
+type BusSegment struct {
+	sim     *Simulation
+	id      int
+	length  int // Stages from one end of the cable to the other
+	taps    []busTap
+	signals []*msgdata // The stage of a signal is its position along the cable
+
+	unterminated [2]bool // Start and far end of the cable
+}
+
+type busTap struct {
+	node junction
+	pos  int
+}
+
+func MakeBusSegment(s *Simulation, length int) *BusSegment {
+	b := &BusSegment{
+		sim:     s,
+		id:      s.nextBusId,
+		length:  length,
+		taps:    make([]busTap, 0),
+		signals: make([]*msgdata, 0),
+	}
+	s.nextBusId++
+	s.register(b)
+	s.buses = append(s.buses, b)
+	return b
+}
+
+// Tap attaches n to the cable at pos, which must lie on the cable and not
+// already hold a tap
+func (b *BusSegment) Tap(n junction, pos int) bool {
+	if pos < 0 || pos > b.length || b.tapAt(pos) != nil || b.Position(n) >= 0 {
+		return false
+	}
+	b.taps = append(b.taps, busTap{node: n, pos: pos})
+	n.attach(b)
+	b.sim.topologyChanged()
+	return true
+}
+
+// CreateTap creates a transceiver tapped onto the cable at pos, or returns
+// nil if the position is not free
+func (b *BusSegment) CreateTap(pos int) *NetworkNode {
+	if pos < 0 || pos > b.length || b.tapAt(pos) != nil {
+		return nil
+	}
+	n := MakeNetworkNode(b.sim)
+	b.Tap(n, pos)
+	return n
+}
+
+func (b *BusSegment) tapAt(pos int) junction {
+	for _, t := range b.taps {
+		if t.pos == pos {
+			return t.node
+		}
+	}
+	return nil
+}
+
+// Position returns where n is tapped onto the cable, or -1
+func (b *BusSegment) Position(n Network) int {
+	for _, t := range b.taps {
+		if t.node == n {
+			return t.pos
+		}
+	}
+	return -1
+}
+
+// SetTerminated terminates or removes the terminator from an end of the
+// cable, 0 for the start and 1 for the far end
+func (b *BusSegment) SetTerminated(end int, terminated bool) { b.unterminated[end] = !terminated }
+func (b *BusSegment) Terminated(end int) bool                { return !b.unterminated[end] }
+
+func (b *BusSegment) Id() int     { return b.id }
+func (b *BusSegment) Length() int { return b.length }
+
+// Taps returns the transceivers and repeaters tapped onto the cable
+func (b *BusSegment) Taps() []Network {
+	nodes := make([]Network, len(b.taps))
+	for i, t := range b.taps {
+		nodes[i] = t.node
+	}
+	return nodes
+}
+func (b *BusSegment) Signals() []*msgdata { return b.signals }
+
+// Network Component Interface
+// Signals move along the cable before transceivers tick
+func (b *BusSegment) TickFalling() bool { return false }
+func (b *BusSegment) Tick() {
+	collide(b.signals)
+
+	for i := len(b.signals) - 1; i >= 0; i-- {
+		sig := b.signals[i]
+		sig.stage += sig.dir
+		if sig.stage < 0 || sig.stage > b.length {
+			b.signals[i] = b.signals[len(b.signals)-1]
+			b.signals = b.signals[:len(b.signals)-1]
+
+			end := 0
+			if sig.stage > b.length {
+				end = 1
+			}
+			if !b.unterminated[end] || sig.reflected {
+				continue
+			}
+			sig = sig.reflect(end * b.length)
+			b.signals = append(b.signals, sig)
+			b.sim.stats.Reflections++
+		}
+		// The signal passes the tap and carries on along the cable
+		if n := b.tapAt(sig.stage); n != nil {
+			n.OnMsg(sig.msg.Copy(), b)
+		}
+	}
+}
+
+// Expects to be called during falling edge of tick
+func (b *BusSegment) OnMsg(msg NetworkMsg, from Network) {
+	pos := b.Position(from)
+	if pos < 0 {
+		return
+	}
+
+	for _, s := range b.signals {
+		if s.stage == pos {
+			interfere(s.msg, msg)
+		}
+	}
+
+	b.signals = append(b.signals,
+		&msgdata{msg: msg, stage: pos, dir: 1},
+		&msgdata{msg: msg.Copy(), stage: pos, dir: -1},
+	)
+}
+
+func (b *BusSegment) incomingMsg(Network) bool { return len(b.signals) > 0 }
+
+func (b *BusSegment) isResetting(from Network) bool {
+	for _, t := range b.taps {
+		if t.node != from && t.node.isResetting(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BusSegment) IsResetting() bool { return b.isResetting(nil) }
+
+func (b *BusSegment) connects(n Network) bool { return n == b || b.Position(n) >= 0 }
+func (b *BusSegment) ends() []Network         { return b.Taps() }
+func (b *BusSegment) neighbours(n junction, visit func(junction, int)) {
+	pos := b.Position(n)
+	for _, t := range b.taps {
+		if t.node != n {
+			visit(t.node, max(t.pos-pos, pos-t.pos))
+		}
+	}
+}
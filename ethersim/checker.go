@@ -0,0 +1,116 @@
+package ethersim
+
+import "fmt"
+
+// Violation is a broken invariant, found at the end of a tick
+type Violation struct {
+	Tick      int
+	Component string // Named like the GUI, e.g. T3 for a transceiver, D2 for a device, E5 for an edge and B1 for a bus
+	Msg       string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("tick %v: (%v) %v", v.Tick, v.Component, v.Msg)
+}
+
+// frameKey identifies a frame by its contents, as delivered frames are copies
+type frameKey struct {
+	from  int
+	to    int
+	value string
+}
+
+// Checker asserts protocol invariants on every tick of a simulation
+type Checker struct {
+	sim         *Simulation
+	violations  []Violation
+	violationCb func(Violation)
+	sending     map[*NetworkNode]NetworkMsg // Frame each transceiver was sending after the last tick
+	sent        map[frameKey]int            // Frames whose transmission ended cleanly and were not yet delivered
+}
+
+// EnableChecker starts checking invariants after every tick
+func (s *Simulation) EnableChecker() *Checker {
+	if s.checker == nil {
+		s.checker = &Checker{
+			sim:     s,
+			sending: make(map[*NetworkNode]NetworkMsg),
+			sent:    make(map[frameKey]int),
+		}
+	}
+	return s.checker
+}
+
+func (c *Checker) Violations() []Violation          { return c.violations }
+func (c *Checker) SetViolationCb(f func(Violation)) { c.violationCb = f }
+
+func (c *Checker) report(component string, format string, args ...any) {
+	v := Violation{Tick: c.sim.ticks, Component: component, Msg: fmt.Sprintf(format, args...)}
+	c.violations = append(c.violations, v)
+	if c.violationCb != nil {
+		c.violationCb(v)
+	}
+}
+
+// onDeviceMsg checks a message as it reaches a device
+func (c *Checker) onDeviceMsg(d *NetworkDevice, msg NetworkMsg) {
+	component := fmt.Sprintf("D%v", d.id)
+	if msg.IsJam() {
+		c.report(component, "received a jam message")
+		return
+	}
+	if !msg.Valid() {
+		c.report(component, "received an invalid message from D%v", msg.From())
+		return
+	}
+	if !msg.IsLast() {
+		return
+	}
+
+	key := frameKey{from: msg.From(), to: msg.Dest(), value: msg.Value()}
+	if c.sent[key] == 0 {
+		c.report(component, "received a message from D%v that was never sent cleanly", msg.From())
+		return
+	}
+	// Every device may receive the same broadcast
+	if !broadcast(msg) {
+		c.sent[key]--
+	}
+}
+
+// check runs at the end of every tick
+func (c *Checker) check() {
+	for _, n := range c.sim.nodes {
+		prev, wasSending := c.sending[n]
+		if wasSending && !n.transmitting && n.transmitRem <= 0 {
+			c.sent[frameKey{from: prev.From(), to: prev.Dest(), value: prev.Value()}]++
+		}
+		delete(c.sending, n)
+		if n.transmitting && len(n.outMessages) > 0 {
+			c.sending[n] = n.outMessages[0]
+		}
+
+		if n.transmitting && n.resetTicks > 0 {
+			c.report(fmt.Sprintf("T%v", n.id), "transmitting while jamming")
+		}
+	}
+
+	for _, e := range c.sim.edges {
+		for _, m := range e.messages {
+			if m.stage < 0 || m.stage > e.weight {
+				c.report(fmt.Sprintf("E%v", e.id), "message at stage %v outside [0, %v]", m.stage, e.weight)
+			}
+			if m.dir != 1 && m.dir != -1 {
+				c.report(fmt.Sprintf("E%v", e.id), "message with direction %v", m.dir)
+			}
+		}
+	}
+
+	for _, b := range c.sim.buses {
+		for _, m := range b.signals {
+			if m.stage < 0 || m.stage > b.length {
+				c.report(fmt.Sprintf("B%v", b.id), "signal at position %v outside [0, %v]", m.stage, b.length)
+			}
+		}
+	}
+}
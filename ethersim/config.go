@@ -0,0 +1,78 @@
+package ethersim
+
+// Config holds the protocol parameters of a simulation
+type Config struct {
+	FrameTicks   int `json:"frame_ticks,omitempty"`   // Ticks a transceiver spends sending a frame
+	JamTicks     int `json:"jam_ticks,omitempty"`     // Ticks a transceiver jams after detecting a collision
+	TimeoutRange int `json:"timeout_range,omitempty"` // Initial upper bound of the random backoff
+	SlotTicks    int `json:"slot_ticks,omitempty"`    // Ticks after which a detected collision counts as late
+
+	MaxTimeoutRange int `json:"max_timeout_range,omitempty"` // Upper bound the backoff range stops doubling at
+	AttemptLimit    int `json:"attempt_limit,omitempty"`     // Collisions after which a message is dropped
+
+	// Spanning tree timers, scaled down from the seconds of IEEE 802.1D
+	HelloTicks        int `json:"hello_ticks,omitempty"`         // Ticks between configuration messages of the root bridge
+	MaxAgeTicks       int `json:"max_age_ticks,omitempty"`       // Ticks after which a bridge forgets what it heard on a port
+	ForwardDelayTicks int `json:"forward_delay_ticks,omitempty"` // Ticks a port spends listening and then learning
+
+	ARPTimeoutTicks int `json:"arp_timeout_ticks,omitempty"` // Ticks a device remembers a resolved address for
+	ARPRetryTicks   int `json:"arp_retry_ticks,omitempty"`   // Ticks a device waits for an ARP reply before asking again
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FrameTicks:   50,
+		JamTicks:     40,
+		TimeoutRange: 20,
+		SlotTicks:    40,
+
+		MaxTimeoutRange: 20 << 10,
+		AttemptLimit:    16,
+
+		HelloTicks:        200,
+		MaxAgeTicks:       1000,
+		ForwardDelayTicks: 600,
+
+		ARPTimeoutTicks: 10000,
+		ARPRetryTicks:   500,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.FrameTicks <= 0 {
+		c.FrameTicks = d.FrameTicks
+	}
+	if c.JamTicks <= 0 {
+		c.JamTicks = d.JamTicks
+	}
+	if c.TimeoutRange <= 0 {
+		c.TimeoutRange = d.TimeoutRange
+	}
+	if c.SlotTicks <= 0 {
+		c.SlotTicks = d.SlotTicks
+	}
+	if c.MaxTimeoutRange <= 0 {
+		c.MaxTimeoutRange = d.MaxTimeoutRange
+	}
+	if c.AttemptLimit <= 0 {
+		c.AttemptLimit = d.AttemptLimit
+	}
+	// Spanning tree timers keep their proportions to the frame time
+	if c.HelloTicks <= 0 {
+		c.HelloTicks = d.HelloTicks * c.FrameTicks / d.FrameTicks
+	}
+	if c.MaxAgeTicks <= 0 {
+		c.MaxAgeTicks = d.MaxAgeTicks * c.FrameTicks / d.FrameTicks
+	}
+	if c.ForwardDelayTicks <= 0 {
+		c.ForwardDelayTicks = d.ForwardDelayTicks * c.FrameTicks / d.FrameTicks
+	}
+	if c.ARPTimeoutTicks <= 0 {
+		c.ARPTimeoutTicks = d.ARPTimeoutTicks * c.FrameTicks / d.FrameTicks
+	}
+	if c.ARPRetryTicks <= 0 {
+		c.ARPRetryTicks = d.ARPRetryTicks * c.FrameTicks / d.FrameTicks
+	}
+	return c
+}
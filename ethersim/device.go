@@ -1,8 +1,5 @@
 package ethersim
 
-var deviceid int = 0
-var numResetTicks int = 40
-
 // Devices
 type NetworkDevice struct {
 	sim            *Simulation
@@ -10,6 +7,8 @@ type NetworkDevice struct {
 	id             int
 	queuedMessages []NetworkMsg
 	lastMessage    NetworkMsg
+	vlan           VLANTag
+	ip             stack
 }
 
 func (n *NetworkNode) CreateDevice(weight int) (*NetworkDevice, *NetworkEdge) {
@@ -17,23 +16,26 @@ func (n *NetworkNode) CreateDevice(weight int) (*NetworkDevice, *NetworkEdge) {
 		return nil, nil
 	}
 	d := &NetworkDevice{
-		id:             deviceid,
+		id:             n.sim.nextDeviceId,
 		sim:            n.sim,
 		queuedMessages: make([]NetworkMsg, 0),
 		network:        nil,
 		lastMessage:    &BaseMsg{Msg: "-", Sender: -1, To: -1},
 	}
-	deviceid++
+	n.sim.nextDeviceId++
 	edge := makeNetworkEdge(n.sim, n, d, weight)
 	n.deviceEdge = edge
 	d.network = edge
 	n.sim.register(d)
+	n.sim.devices = append(n.sim.devices, d)
 	// d.randomizeTimeout()
 	return d, edge
 }
 func (d *NetworkDevice) Id() int           { return d.id }
+func (d *NetworkDevice) MAC() MAC          { return MACOf(d.id) }
 func (d *NetworkDevice) TickFalling() bool { return true }
 func (d *NetworkDevice) Tick() {
+	d.tickARP()
 
 	if len(d.queuedMessages) > 0 && !d.network.incomingMsg(d) && !d.network.isResetting(d) {
 		msg := d.queuedMessages[0]
@@ -44,9 +46,16 @@ func (d *NetworkDevice) Tick() {
 
 // Expects to be called during rising edge of tick
 func (d *NetworkDevice) OnMsg(msg NetworkMsg, sender Network) {
+	if t := VLANOf(msg); d.vlan.Tagged() && t.Tagged() && t.ID != d.vlan.ID {
+		return
+	}
+	if d.sim.checker != nil {
+		d.sim.checker.onDeviceMsg(d, msg)
+	}
 	if msg.IsLast() {
 		d.lastMessage = msg.Copy()
-		d.sim.onDeviceReceiveMsg(d.id, msg.Copy())
+		d.sim.onDeviceReceiveMsg(d.id, msg)
+		d.handleFrame(msg)
 	}
 }
 
@@ -54,9 +63,14 @@ func (d *NetworkDevice) incomingMsg(Network) bool { return false }
 func (d *NetworkDevice) IncomingMsg() bool        { return d.network.incomingMsg(d) }
 func (d *NetworkDevice) QueueMessage(msg NetworkMsg) {
 
+	if t, ok := msg.(Tagged); ok && d.vlan.Tagged() && !t.VLAN().Tagged() {
+		t.SetVLAN(d.vlan)
+	}
 	if len(d.queuedMessages) < 100 {
 		d.queuedMessages = append(d.queuedMessages, msg)
-		d.sim.onDeviceQueueMsg(d.id, msg.Copy())
+		d.sim.onDeviceQueueMsg(d.id, msg)
+	} else {
+		d.sim.onDeviceDropMsg(d.id, msg)
 	}
 }
 
@@ -1,32 +1,51 @@
 package ethersim
 
-var edgeid int = 0
+import (
+	"fmt"
+	"slices"
+)
 
 type msgdata struct {
-	msg   NetworkMsg
-	stage int // between 0 and weight of edge incl
-	dir   int // 1 or -1
+	msg       NetworkMsg
+	stage     int  // between 0 and weight of edge incl
+	dir       int  // 1 or -1
+	reflected bool // Echo of a message off an unterminated end
 }
 
 func (m *msgdata) Msg() NetworkMsg { return m.msg }
 func (m *msgdata) Stage() int      { return m.stage }
 func (m *msgdata) Dir() int        { return m.dir }
+func (m *msgdata) Reflected() bool { return m.reflected }
+
+// reflect returns the echo of m off an unterminated end, travelling back the
+// way m came. Echoes are distorted and too weak to be reflected again.
+func (m *msgdata) reflect(stage int) *msgdata {
+	msg := m.msg.Copy()
+	msg.Invalid()
+	return &msgdata{msg: msg, stage: stage, dir: -m.dir, reflected: true}
+}
 
 type NetworkEdge struct {
+	sim      *Simulation
 	id       int
 	n1       Network
 	n2       Network
 	edge     bool
+	duplex   bool // Messages in opposite directions travel on separate channels
 	weight   int
 	messages []*msgdata
 	incn1    bool
 	incn2    bool
+
+	unterminated1 bool // Messages arriving at n1 are reflected back into the edge
+	unterminated2 bool
 }
 
 func makeNetworkEdge(s *Simulation, n1 Network, n2 Network, w int) *NetworkEdge {
-	id := edgeid
-	edgeid++
+	id := s.nextEdgeId
+	s.nextEdgeId++
 	edge := &NetworkEdge{
+		sim:      s,
 		id:       id,
 		n1:       n1,
 		n2:       n2,
@@ -37,36 +56,51 @@ func makeNetworkEdge(s *Simulation, n1 Network, n2 Network, w int) *NetworkEdge
 		incn2:    false,
 	}
 	s.register(edge)
+	s.edges = append(s.edges, edge)
+	s.topologyChanged()
 
 	return edge
 }
 
 func (e *NetworkEdge) Id() int { return e.id }
 
-func (e *NetworkEdge) TickFalling() bool { return false }
-func (e *NetworkEdge) Tick() {
-	dirs := make(map[int]int) // Maps stages to directions
-	for _, msg := range e.messages {
-		if v, ok := dirs[msg.stage]; !ok {
-			dirs[msg.stage] = msg.dir
-		} else if v != msg.dir {
-			dirs[msg.stage] = 0
-		}
+// RemoveEdge takes an edge between transceivers, repeaters or switches out of
+// the simulation, as if its cable were cut. The messages on it are lost.
+func (s *Simulation) RemoveEdge(e *NetworkEdge) error {
+	j1, ok1 := e.n1.(junction)
+	j2, ok2 := e.n2.(junction)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("E%v leads to a device and cannot be removed", e.id)
+	}
+	if !slices.Contains(s.edges, e) {
+		return fmt.Errorf("E%v is not part of the simulation", e.id)
 	}
+	s.edges = slices.DeleteFunc(s.edges, func(o *NetworkEdge) bool { return o == e })
+	s.components = slices.DeleteFunc(s.components, func(c NetworkComponent) bool { return c == NetworkComponent(e) })
+	e.messages = e.messages[:0]
+	j1.detach(e)
+	j2.detach(e)
+	s.topologyChanged()
+	return nil
+}
 
-	for _, msg := range e.messages {
-		if !msg.msg.Valid() {
-			continue
-		}
-		// Case 1: Two messages will swap stages
-		if v, ok := dirs[msg.stage+msg.dir]; ok && v != msg.dir {
-			msg.msg.Invalid()
-		}
-		// Case 2: Two messages will be at the same stage
-		if v, ok := dirs[msg.stage+2*msg.dir]; ok && v != msg.dir {
-			msg.msg.Invalid()
+// collide spoils messages that are about to meet one travelling the other way,
+// either swapping stages or reaching the same stage
+func collide(messages []*msgdata) {
+	for i, a := range messages {
+		for _, b := range messages[i+1:] {
+			if a.dir != b.dir && (a.stage+a.dir == b.stage || a.stage+2*a.dir == b.stage) {
+				interfere(a.msg, b.msg)
+			}
 		}
 	}
+}
+
+func (e *NetworkEdge) TickFalling() bool { return false }
+func (e *NetworkEdge) Tick() {
+	if !e.duplex {
+		collide(e.messages)
+	}
 
 	e.incn1 = false
 	e.incn2 = false
@@ -85,11 +119,19 @@ func (e *NetworkEdge) Tick() {
 			e.messages[i] = e.messages[len(e.messages)-1]
 			e.messages = e.messages[:len(e.messages)-1]
 
+			if e.unterminated1 && !msg.reflected {
+				e.messages = append(e.messages, msg.reflect(0))
+				e.sim.stats.Reflections++
+			}
 			e.n1.OnMsg(msg.msg, e.n2)
 		} else if msg.stage >= e.weight {
 			e.messages[i] = e.messages[len(e.messages)-1]
 			e.messages = e.messages[:len(e.messages)-1]
 
+			if e.unterminated2 && !msg.reflected {
+				e.messages = append(e.messages, msg.reflect(e.weight))
+				e.sim.stats.Reflections++
+			}
 			e.n2.OnMsg(msg.msg, e.n1)
 		}
 	}
@@ -110,9 +152,8 @@ func (e *NetworkEdge) OnMsg(msg NetworkMsg, from Network) {
 	}
 
 	for _, m2 := range e.messages {
-		if m2.stage == start {
-			m2.msg.Invalid()
-			msg.Invalid()
+		if m2.stage == start && (!e.duplex || m2.dir == dir) {
+			interfere(m2.msg, msg)
 		}
 	}
 
@@ -134,8 +175,44 @@ func (e *NetworkEdge) incomingMsg(dest Network) bool {
 	return false
 }
 
-func (e *NetworkEdge) Weight() int          { return e.weight }
-func (e *NetworkEdge) Messages() []*msgdata { return e.messages }
+// other returns the endpoint opposite to n
+func (e *NetworkEdge) other(n Network) Network {
+	if n == e.n1 {
+		return e.n2
+	}
+	return e.n1
+}
+
+func (e *NetworkEdge) connects(n Network) bool { return n == e.n1 || n == e.n2 }
+func (e *NetworkEdge) ends() []Network         { return []Network{e.n1, e.n2} }
+func (e *NetworkEdge) neighbours(n junction, visit func(junction, int)) {
+	if next, ok := e.other(n).(junction); ok {
+		visit(next, e.weight)
+	}
+}
+
+// SetTerminated terminates or removes the terminator from the end of the edge at n
+func (e *NetworkEdge) SetTerminated(n Network, terminated bool) {
+	if n == e.n1 {
+		e.unterminated1 = !terminated
+	} else if n == e.n2 {
+		e.unterminated2 = !terminated
+	}
+}
+
+func (e *NetworkEdge) Terminated(n Network) bool {
+	if n == e.n1 {
+		return !e.unterminated1
+	}
+	return n != e.n2 || !e.unterminated2
+}
+
+// SetDuplex gives the edge an independent channel in each direction, so that
+// messages travelling in opposite directions no longer collide
+func (e *NetworkEdge) SetDuplex(duplex bool) { e.duplex = duplex }
+func (e *NetworkEdge) Duplex() bool          { return e.duplex }
+func (e *NetworkEdge) Weight() int           { return e.weight }
+func (e *NetworkEdge) Messages() []*msgdata  { return e.messages }
 func (e *NetworkEdge) isResetting(from Network) bool {
 	if from == e.n1 {
 		return e.n2.isResetting(e)
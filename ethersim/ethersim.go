@@ -26,22 +26,49 @@ type Network interface {
 	isResetting(from Network) bool
 }
 
+// link is a medium between transceivers, either an edge or a bus segment
+type link interface {
+	Network
+	// connects reports whether a message from n arrived over the link
+	connects(n Network) bool
+	// neighbours visits every junction reachable over the link from n
+	// together with the ticks a message takes to reach it
+	neighbours(n junction, visit func(junction, int))
+	// ends returns everything attached to the link
+	ends() []Network
+}
+
+// junction is where links meet, either a transceiver, a repeater or a switch
+type junction interface {
+	Network
+	attach(l link)
+	detach(l link)
+	links() []link
+	passDelay() int // Ticks a message takes to pass through
+}
+
 type BaseMsg struct {
 	V      bool
 	Msg    string
 	Sender int
 	Last   bool
 	To     int
+	Tag    VLANTag
+	SeqCtl SequenceControl
 }
 
-func (m *BaseMsg) Valid() bool   { return m.V }
-func (m *BaseMsg) Invalid()      { m.V = false }
-func (m *BaseMsg) From() int     { return m.Sender }
-func (m *BaseMsg) IsJam() bool   { return false }
-func (m *BaseMsg) IsLast() bool  { return m.Last }
-func (m *BaseMsg) Value() string { return m.Msg }
-func (m *BaseMsg) Dest() int     { return m.To }
-func (m *BaseMsg) SetLast()      { m.Last = true }
+func (m *BaseMsg) Valid() bool                          { return m.V }
+func (m *BaseMsg) Invalid()                             { m.V = false }
+func (m *BaseMsg) From() int                            { return m.Sender }
+func (m *BaseMsg) IsJam() bool                          { return false }
+func (m *BaseMsg) IsLast() bool                         { return m.Last }
+func (m *BaseMsg) Value() string                        { return m.Msg }
+func (m *BaseMsg) Dest() int                            { return m.To }
+func (m *BaseMsg) SetLast()                             { m.Last = true }
+func (m *BaseMsg) VLAN() VLANTag                        { return m.Tag }
+func (m *BaseMsg) SetVLAN(t VLANTag)                    { m.Tag = t }
+func (m *BaseMsg) SequenceControl() SequenceControl     { return m.SeqCtl }
+func (m *BaseMsg) SetSequenceControl(c SequenceControl) { m.SeqCtl = c }
 func (m *BaseMsg) Copy() NetworkMsg {
 	return &BaseMsg{
 		V:      m.V,
@@ -49,6 +76,8 @@ func (m *BaseMsg) Copy() NetworkMsg {
 		Msg:    m.Msg,
 		To:     m.To,
 		Last:   m.Last,
+		Tag:    m.Tag,
+		SeqCtl: m.SeqCtl,
 	}
 }
 
@@ -63,3 +92,67 @@ func (m *JamMsg) IsLast() bool     { return true }
 func (m *JamMsg) Dest() int        { return -1 }
 func (m *JamMsg) SetLast()         {}
 func (m *JamMsg) Copy() NetworkMsg { return &JamMsg{Sender: m.Sender} }
+
+// ReserveMsg is a single reservation bit sent during a contention slot
+type ReserveMsg struct{ Sender int }
+
+func (m *ReserveMsg) Valid() bool      { return true }
+func (m *ReserveMsg) Value() string    { return "" }
+func (m *ReserveMsg) Invalid()         {}
+func (m *ReserveMsg) From() int        { return m.Sender }
+func (m *ReserveMsg) IsJam() bool      { return false }
+func (m *ReserveMsg) IsLast() bool     { return false }
+func (m *ReserveMsg) Dest() int        { return -1 }
+func (m *ReserveMsg) SetLast()         {}
+func (m *ReserveMsg) Copy() NetworkMsg { return &ReserveMsg{Sender: m.Sender} }
+
+type ControlKind int
+
+const (
+	ControlRTS ControlKind = iota
+	ControlCTS
+	ControlACK
+)
+
+func (k ControlKind) String() string {
+	switch k {
+	case ControlRTS:
+		return "RTS"
+	case ControlCTS:
+		return "CTS"
+	case ControlACK:
+		return "ACK"
+	}
+	return "?"
+}
+
+// ControlMsg is a link-layer control frame used by collision avoidance
+type ControlMsg struct {
+	V        bool
+	Kind     ControlKind
+	Sender   int
+	To       int
+	Duration int // Ticks the medium stays reserved after the frame ends
+	Seq      int // Sequence number of the data frame an ACK answers
+	Last     bool
+}
+
+func (m *ControlMsg) Valid() bool   { return m.V }
+func (m *ControlMsg) Invalid()      { m.V = false }
+func (m *ControlMsg) From() int     { return m.Sender }
+func (m *ControlMsg) IsJam() bool   { return false }
+func (m *ControlMsg) IsLast() bool  { return m.Last }
+func (m *ControlMsg) Value() string { return m.Kind.String() }
+func (m *ControlMsg) Dest() int     { return m.To }
+func (m *ControlMsg) SetLast()      { m.Last = true }
+func (m *ControlMsg) Copy() NetworkMsg {
+	return &ControlMsg{
+		V:        m.V,
+		Kind:     m.Kind,
+		Sender:   m.Sender,
+		To:       m.To,
+		Duration: m.Duration,
+		Seq:      m.Seq,
+		Last:     m.Last,
+	}
+}
@@ -0,0 +1,165 @@
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+	"github.com/willtrojniak/ethersim/ethersim/analysis"
+)
+
+// Replication is the outcome of a single run of a scenario
+type Replication struct {
+	Seed  uint64
+	Stats ethersim.Stats
+}
+
+// Batch aggregates independent replications of a scenario
+type Batch struct {
+	Scenario       Scenario
+	Replications   []Replication
+	OfferedLoad    Summary
+	Efficiency     Summary
+	Throughput     Summary
+	Delay          Summary
+	Collisions     Summary
+	Late           Summary // Late collisions
+	Reflections    Summary
+	CodeViolations Summary
+	ChecksumErrors Summary
+	ARP            Summary // ARP requests and replies
+	Unreachable    Summary // IPv4 packets whose destination ARP could not resolve
+
+	// Only set for scenarios with a physical layer
+	DelayMicros   Summary
+	BitThroughput Summary
+
+	Model     analysis.Model
+	Slot      analysis.SlotTime
+	Predicted float64 // Efficiency predicted by the model
+	Deviation float64 // Mean simulated efficiency minus the predicted efficiency
+}
+
+// Summary describes a sample of a metric over replications
+type Summary struct {
+	N        int     `json:"n"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"` // Sample variance
+	CI       float64 `json:"ci"`       // Half width of the 95% confidence interval of the mean
+}
+
+// RunBatch runs the scenario runs times on a pool of workers. Replication i
+// is seeded with seed+i, so a batch is reproducible regardless of workers.
+func RunBatch(sc Scenario, runs int, workers int, seed uint64) (*Batch, error) {
+	if runs <= 0 {
+		return nil, fmt.Errorf("runs must be positive, not %v", runs)
+	}
+	reps := make([]Replication, runs)
+	errs := make([]error, runs)
+	parallel(runs, workers, func(i int) {
+		reps[i].Seed = seed + uint64(i)
+		reps[i].Stats, errs[i] = sc.Run(reps[i].Seed)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return makeBatch(sc, reps)
+}
+
+func makeBatch(sc Scenario, reps []Replication) (*Batch, error) {
+	model, err := sc.Model()
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := sc.SlotTime()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Batch{Scenario: sc, Replications: reps, Model: model, Slot: slot}
+	b.OfferedLoad = b.summarize(ethersim.Stats.OfferedLoad)
+	b.Efficiency = b.summarize(ethersim.Stats.Efficiency)
+	b.Throughput = b.summarize(ethersim.Stats.Throughput)
+	b.Delay = b.summarize(ethersim.Stats.MeanDelay)
+	b.Collisions = b.summarize(func(s ethersim.Stats) float64 { return float64(s.Collisions) })
+	b.Late = b.summarize(func(s ethersim.Stats) float64 { return float64(s.LateCollisions) })
+	b.Reflections = b.summarize(func(s ethersim.Stats) float64 { return float64(s.Reflections) })
+	b.CodeViolations = b.summarize(func(s ethersim.Stats) float64 { return float64(s.CodeViolations) })
+	b.ChecksumErrors = b.summarize(func(s ethersim.Stats) float64 { return float64(s.ChecksumErrors) })
+	b.ARP = b.summarize(func(s ethersim.Stats) float64 { return float64(s.ARPRequests + s.ARPReplies) })
+	b.Unreachable = b.summarize(func(s ethersim.Stats) float64 { return float64(s.Unreachable) })
+	if sc.Physical.Enabled() {
+		b.DelayMicros = b.summarize(ethersim.Stats.MeanDelayMicros)
+		b.BitThroughput = b.summarize(ethersim.Stats.BitThroughput)
+	}
+	b.Predicted = model.Efficiency()
+	b.Deviation = b.Efficiency.Mean - b.Predicted
+	return b, nil
+}
+
+// parallel calls job for 0 to n-1 on a pool of workers
+func parallel(n int, workers int, job func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				job(i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (b *Batch) summarize(metric func(ethersim.Stats) float64) Summary {
+	xs := make([]float64, len(b.Replications))
+	for i, r := range b.Replications {
+		xs[i] = metric(r.Stats)
+	}
+	return Summarize(xs)
+}
+
+// Summarize computes the mean, variance and confidence interval of a sample
+func Summarize(xs []float64) Summary {
+	s := Summary{N: len(xs)}
+	if s.N == 0 {
+		return s
+	}
+	for _, x := range xs {
+		s.Mean += x
+	}
+	s.Mean /= float64(s.N)
+	if s.N == 1 {
+		return s
+	}
+
+	for _, x := range xs {
+		s.Variance += (x - s.Mean) * (x - s.Mean)
+	}
+	s.Variance /= float64(s.N - 1)
+	s.CI = tQuantile(s.N-1) * math.Sqrt(s.Variance/float64(s.N))
+	return s
+}
+
+// tQuantiles holds the 97.5th percentile of Student's t-distribution for 1 to 30 degrees of freedom
+var tQuantiles = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tQuantile(df int) float64 {
+	if df <= len(tQuantiles) {
+		return tQuantiles[df-1]
+	}
+	return 1.96
+}
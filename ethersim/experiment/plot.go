@@ -0,0 +1,97 @@
+package experiment
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	plotWidth   = 640
+	plotHeight  = 420
+	plotMargin  = 60
+	plotTickNum = 5
+)
+
+var plotColors = []string{"#456990", "#ef767a", "#49baaa", "#8b1e3f", "#c75000", "#8f43ee", "#95bf74"}
+
+// WriteSVG plots throughput against offered load, both in frames per frame
+// time. Points that differ in anything but the load form separate series,
+// each with the efficiency predicted by the model as a dashed line.
+func (sw *Sweep) WriteSVG(w io.Writer) error {
+	type series struct {
+		label  string
+		points []*Point
+	}
+	all := make([]*series, 0)
+	byLabel := make(map[string]*series)
+	maxX, maxY := 1.0, 1.0
+	for i := range sw.Points {
+		p := &sw.Points[i]
+		label := sw.seriesLabel(p)
+		if byLabel[label] == nil {
+			byLabel[label] = &series{label: label}
+			all = append(all, byLabel[label])
+		}
+		byLabel[label].points = append(byLabel[label].points, p)
+		maxX = max(maxX, p.OfferedLoad.Mean)
+		maxY = max(maxY, p.Efficiency.Mean+p.Efficiency.CI)
+	}
+	maxX = math.Ceil(maxX)
+
+	px := func(x float64) float64 { return plotMargin + x/maxX*(plotWidth-2*plotMargin) }
+	py := func(y float64) float64 { return plotHeight - plotMargin - y/maxY*(plotHeight-2*plotMargin) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" font-family="sans-serif" font-size="12">`+"\n", plotWidth, plotHeight)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	// Axes with ticks
+	x0, y0 := px(0), py(0)
+	fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", x0, y0, px(maxX), y0)
+	fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", x0, y0, x0, py(maxY))
+	for i := 0; i <= plotTickNum; i++ {
+		x := maxX * float64(i) / plotTickNum
+		y := maxY * float64(i) / plotTickNum
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%.2g</text>`+"\n", px(x), y0+18, x)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end">%.2g</text>`+"\n", x0-8, py(y)+4, y)
+	}
+	fmt.Fprintf(&b, `<text x="%v" y="%v" text-anchor="middle">Offered load (frames per frame time)</text>`+"\n", plotWidth/2, plotHeight-15)
+	fmt.Fprintf(&b, `<text x="15" y="%v" text-anchor="middle" transform="rotate(-90 15 %v)">Throughput (frames per frame time)</text>`+"\n", plotHeight/2, plotHeight/2)
+
+	for i, s := range all {
+		col := plotColors[i%len(plotColors)]
+		coords := make([]string, len(s.points))
+		predicted := make([]string, len(s.points))
+		for j, p := range s.points {
+			predicted[j] = fmt.Sprintf("%.1f,%.1f", px(p.OfferedLoad.Mean), py(p.Predicted))
+			x, y := px(p.OfferedLoad.Mean), py(p.Efficiency.Mean)
+			coords[j] = fmt.Sprintf("%.1f,%.1f", x, y)
+			// Error bar of the 95% confidence interval
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%v"/>`+"\n",
+				x, py(p.Efficiency.Mean-p.Efficiency.CI), x, py(p.Efficiency.Mean+p.Efficiency.CI), col)
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%v"/>`+"\n", x, y, col)
+		}
+		fmt.Fprintf(&b, `<polyline points="%v" fill="none" stroke="%v" stroke-width="2"/>`+"\n", strings.Join(coords, " "), col)
+		fmt.Fprintf(&b, `<polyline points="%v" fill="none" stroke="%v" stroke-dasharray="4 4"/>`+"\n", strings.Join(predicted, " "), col)
+		if s.label != "" {
+			fmt.Fprintf(&b, `<text x="%v" y="%v" fill="%v">%v</text>`+"\n", plotWidth-plotMargin-150, plotMargin+i*16, col, s.label)
+		}
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// seriesLabel names the values of every parameter but the load
+func (sw *Sweep) seriesLabel(p *Point) string {
+	parts := make([]string, 0)
+	for i, param := range sw.Params {
+		if param.Name != "load" {
+			parts = append(parts, fmt.Sprintf("%v=%g", param.Name, p.Values[i]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
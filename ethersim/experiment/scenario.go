@@ -0,0 +1,259 @@
+package experiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+	"github.com/willtrojniak/ethersim/ethersim/analysis"
+)
+
+// Scenario is a topology together with its traffic, run for a fixed number
+// of ticks. The topology is either generated from a shape or given in full.
+type Scenario struct {
+	Name         string               `json:"name"`
+	Ticks        int                  `json:"ticks"`
+	Load         float64              `json:"load"`                   // Probability per tick that a device queues a message
+	OfferedLoad  float64              `json:"offered_load,omitempty"` // Frames offered per frame time, overrides Load
+	Protocol     ethersim.Protocol    `json:"protocol"`
+	Config       ethersim.Config      `json:"config"`
+	Physical     ethersim.Physical    `json:"physical"`
+	Format       ethersim.FrameFormat `json:"format,omitempty"`     // Messages the traffic is made of
+	Signalling   ethersim.Signalling  `json:"signalling,omitempty"` // How frames are put on the ether
+	Shape        string               `json:"shape,omitempty"`      // "line", "star", "switched", "vlan", "redundant", "bus" or "repeated"
+	Devices      int                  `json:"devices,omitempty"`    // Devices per segment for the repeated shape
+	Weight       int                  `json:"weight,omitempty"`
+	Segments     int                  `json:"segments,omitempty"`      // Bus segments joined by repeaters
+	Delay        int                  `json:"delay,omitempty"`         // Ticks each repeater takes
+	VLANs        int                  `json:"vlans,omitempty"`         // VLANs the switch ports of the vlan shape alternate between
+	SpanningTree bool                 `json:"spanning_tree,omitempty"` // Switches run the spanning tree protocol
+	Subnet       string               `json:"subnet,omitempty"`        // IPv4 subnet to address devices from, so that traffic goes over IPv4 and ARP
+	Topology     ethersim.Topology    `json:"topology"`
+	Faults       []NodeFault          `json:"faults,omitempty"`
+	Check        bool                 `json:"check,omitempty"` // Fail runs that break a protocol invariant
+}
+
+// NodeFault schedules a fault on the transceiver with the given id
+type NodeFault struct {
+	Node int `json:"node"`
+	ethersim.Fault
+}
+
+// Builtin holds the canonical scenarios by name
+var Builtin = map[string]Scenario{
+	"pair": {
+		Name:    "pair",
+		Ticks:   10000,
+		Load:    0.01,
+		Shape:   "line",
+		Devices: 2,
+		Weight:  4,
+	},
+	"line": {
+		Name:    "line",
+		Ticks:   10000,
+		Load:    0.002,
+		Shape:   "line",
+		Devices: 5,
+		Weight:  4,
+	},
+	"bus": {
+		Name:    "bus",
+		Ticks:   10000,
+		Load:    0.002,
+		Shape:   "bus",
+		Devices: 5,
+		Weight:  4,
+	},
+	"repeated": {
+		Name:     "repeated",
+		Ticks:    10000,
+		Load:     0.002,
+		Shape:    "repeated",
+		Segments: 3,
+		Devices:  2,
+		Weight:   4,
+		Delay:    2,
+		Config:   ethersim.Config{FrameTicks: 80},
+	},
+	"star": {
+		Name:    "star",
+		Ticks:   10000,
+		Load:    0.01,
+		Shape:   "star",
+		Devices: 8,
+		Weight:  4,
+	},
+	"switched": {
+		Name:    "switched",
+		Ticks:   10000,
+		Load:    0.01,
+		Shape:   "switched",
+		Devices: 8,
+		Weight:  4,
+	},
+	"vlan": {
+		Name:    "vlan",
+		Ticks:   10000,
+		Load:    0.01,
+		Shape:   "vlan",
+		Devices: 8,
+		Weight:  4,
+		VLANs:   2,
+	},
+	"redundant": {
+		Name:         "redundant",
+		Ticks:        10000,
+		Load:         0.002,
+		Shape:        "redundant",
+		Devices:      4,
+		Weight:       4,
+		SpanningTree: true,
+	},
+}
+
+// LoadScenario returns the builtin scenario with the given name, or reads
+// the scenario from the JSON file at that path
+func LoadScenario(name string) (Scenario, error) {
+	if sc, ok := Builtin[name]; ok {
+		return sc, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("no builtin scenario or file named %q", name)
+	}
+	defer f.Close()
+	return ReadScenario(f)
+}
+
+func ReadScenario(r io.Reader) (Scenario, error) {
+	var sc Scenario
+	if err := json.NewDecoder(r).Decode(&sc); err != nil {
+		return Scenario{}, err
+	}
+	if sc.Ticks <= 0 {
+		return Scenario{}, fmt.Errorf("scenario %q: ticks must be positive", sc.Name)
+	}
+	return sc, nil
+}
+
+// topology returns the topology of the scenario, generating it from the shape if set
+func (sc *Scenario) topology() (ethersim.Topology, error) {
+	switch sc.Shape {
+	case "":
+		return sc.Topology, nil
+	case "line":
+		return ethersim.LineTopology(sc.Devices, sc.Weight), nil
+	case "star":
+		return ethersim.StarTopology(sc.Devices, sc.Weight), nil
+	case "switched":
+		return ethersim.SwitchedTopology(sc.Devices, sc.Weight), nil
+	case "vlan":
+		return ethersim.VLANTopology(sc.Devices, sc.Weight, sc.VLANs), nil
+	case "redundant":
+		return ethersim.RedundantTopology(sc.Devices, sc.Weight), nil
+	case "bus":
+		return ethersim.BusTopology(sc.Devices, sc.Weight), nil
+	case "repeated":
+		return ethersim.RepeatedBusTopology(sc.Segments, sc.Devices, sc.Weight, sc.Delay), nil
+	}
+	return ethersim.Topology{}, fmt.Errorf("scenario %q: unknown shape %q", sc.Name, sc.Shape)
+}
+
+// rate returns the probability per tick that a device queues a message
+func (sc *Scenario) rate(devices int, frameTicks int) float64 {
+	if sc.OfferedLoad <= 0 {
+		return sc.Load
+	}
+	if devices == 0 {
+		return 0
+	}
+	return sc.OfferedLoad / float64(devices*frameTicks)
+}
+
+// Build creates a fresh simulation of the scenario
+func (sc *Scenario) Build(seed uint64) (*ethersim.Simulation, error) {
+	t, err := sc.topology()
+	if err != nil {
+		return nil, err
+	}
+
+	s := ethersim.MakeSeededSimulation(seed)
+	s.SetConfig(sc.Config)
+	s.SetPhysical(sc.Physical)
+	s.SetFrameFormat(sc.Format)
+	s.SetSignalling(sc.Signalling)
+	if _, err := t.Build(s); err != nil {
+		return nil, fmt.Errorf("scenario %q: %w", sc.Name, err)
+	}
+	if sc.Subnet != "" {
+		subnet, err := netip.ParsePrefix(sc.Subnet)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q: %w", sc.Name, err)
+		}
+		if err := s.AssignIPs(subnet); err != nil {
+			return nil, fmt.Errorf("scenario %q: %w", sc.Name, err)
+		}
+	}
+	s.SetSpanningTree(sc.SpanningTree)
+	s.SetProtocol(sc.Protocol)
+	for _, f := range sc.Faults {
+		if f.Node < 0 || f.Node >= len(s.Nodes()) {
+			return nil, fmt.Errorf("scenario %q: fault on unknown transceiver %v", sc.Name, f.Node)
+		}
+		s.Nodes()[f.Node].InjectFault(f.Fault)
+	}
+	ethersim.MakeTraffic(s, sc.rate(len(s.Devices()), s.Config().FrameTicks))
+	return s, nil
+}
+
+// Run simulates the scenario once and returns its statistics
+func (sc *Scenario) Run(seed uint64) (ethersim.Stats, error) {
+	s, err := sc.Build(seed)
+	if err != nil {
+		return ethersim.Stats{}, err
+	}
+	var checker *ethersim.Checker
+	if sc.Check {
+		checker = s.EnableChecker()
+	}
+	for range sc.Ticks {
+		s.Tick()
+	}
+	if checker != nil && len(checker.Violations()) > 0 {
+		v := checker.Violations()
+		return ethersim.Stats{}, fmt.Errorf("scenario %q seed %v: %w (%v violations)", sc.Name, seed, v[0], len(v))
+	}
+	return s.Stats(), nil
+}
+
+// Model returns the analytical efficiency model of the scenario's topology
+func (sc *Scenario) Model() (analysis.Model, error) {
+	s, err := sc.Build(0)
+	if err != nil {
+		return analysis.Model{}, err
+	}
+	return analysis.MetcalfeBoggs(s), nil
+}
+
+// SlotTime returns the slot time analysis of the scenario's topology
+func (sc *Scenario) SlotTime() (analysis.SlotTime, error) {
+	s, err := sc.Build(0)
+	if err != nil {
+		return analysis.SlotTime{}, err
+	}
+	return analysis.SlotTimeOf(s), nil
+}
+
+// Validate returns the warnings about the scenario's topology
+func (sc *Scenario) Validate() ([]error, error) {
+	s, err := sc.Build(0)
+	if err != nil {
+		return nil, err
+	}
+	return s.ValidateTopology(), nil
+}
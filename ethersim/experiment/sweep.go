@@ -0,0 +1,242 @@
+package experiment
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Param is a scenario parameter together with the values it takes in a sweep
+type Param struct {
+	Name   string
+	Values []float64
+}
+
+// Params lists the scenario parameters that can be swept
+var Params = []string{"load", "devices", "weight", "frame", "jam", "timeout", "slot"}
+
+// ParseParam parses "name=start:stop:step" or "name=v1,v2,..."
+func ParseParam(s string) (Param, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok {
+		return Param{}, fmt.Errorf("parameter %q: expected name=values", s)
+	}
+	p := Param{Name: name}
+	if !validParam(name) {
+		return p, fmt.Errorf("unknown parameter %q, expected one of %v", name, strings.Join(Params, ", "))
+	}
+
+	if parts := strings.Split(spec, ":"); len(parts) == 3 {
+		var r [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return p, fmt.Errorf("parameter %v: %w", name, err)
+			}
+			r[i] = v
+		}
+		if r[2] <= 0 {
+			return p, fmt.Errorf("parameter %v: step must be positive", name)
+		}
+		// Index the values rather than accumulating to avoid drifting past stop
+		for i := 0; r[0]+float64(i)*r[2] <= r[1]+r[2]*1e-9; i++ {
+			p.Values = append(p.Values, math.Round((r[0]+float64(i)*r[2])*1e9)/1e9)
+		}
+		return p, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return p, fmt.Errorf("parameter %v: %w", name, err)
+		}
+		p.Values = append(p.Values, v)
+	}
+	return p, nil
+}
+
+func validParam(name string) bool {
+	for _, p := range Params {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Set changes a sweepable parameter of the scenario
+func (sc *Scenario) Set(name string, v float64) error {
+	if (name == "devices" || name == "weight") && sc.Shape == "" {
+		return fmt.Errorf("scenario %q: %v can only be swept for generated shapes", sc.Name, name)
+	}
+
+	switch name {
+	case "load":
+		sc.Load, sc.OfferedLoad = v, 0
+	case "devices":
+		sc.Devices = int(v)
+	case "weight":
+		sc.Weight = int(v)
+	case "frame":
+		sc.Config.FrameTicks = int(v)
+	case "jam":
+		sc.Config.JamTicks = int(v)
+	case "timeout":
+		sc.Config.TimeoutRange = int(v)
+	case "slot":
+		sc.Config.SlotTicks = int(v)
+	default:
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+	return nil
+}
+
+// Point is a single combination of parameter values and its results
+type Point struct {
+	Values []float64 // In the order of Sweep.Params
+	*Batch
+}
+
+// Sweep holds the results of a scenario over the cartesian product of its parameters
+type Sweep struct {
+	Params []Param
+	Points []Point
+}
+
+// RunSweep runs every combination of parameter values runs times. All
+// replications of all points share one pool of workers.
+func RunSweep(sc Scenario, params []Param, runs int, workers int, seed uint64) (*Sweep, error) {
+	if runs <= 0 {
+		return nil, fmt.Errorf("runs must be positive, not %v", runs)
+	}
+	sw := &Sweep{Params: params}
+	scenarios := make([]Scenario, 0)
+	for _, values := range product(params) {
+		psc := sc
+		for i, p := range params {
+			if err := psc.Set(p.Name, values[i]); err != nil {
+				return nil, err
+			}
+		}
+		scenarios = append(scenarios, psc)
+		sw.Points = append(sw.Points, Point{Values: values})
+	}
+
+	reps := make([]Replication, len(scenarios)*runs)
+	errs := make([]error, len(reps))
+	parallel(len(reps), workers, func(i int) {
+		reps[i].Seed = seed + uint64(i%runs)
+		reps[i].Stats, errs[i] = scenarios[i/runs].Run(reps[i].Seed)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	for i := range sw.Points {
+		b, err := makeBatch(scenarios[i], reps[i*runs:(i+1)*runs])
+		if err != nil {
+			return nil, err
+		}
+		sw.Points[i].Batch = b
+	}
+	return sw, nil
+}
+
+// product returns every combination of parameter values, varying the last parameter fastest
+func product(params []Param) [][]float64 {
+	combos := [][]float64{{}}
+	for _, p := range params {
+		next := make([][]float64, 0, len(combos)*len(p.Values))
+		for _, c := range combos {
+			for _, v := range p.Values {
+				next = append(next, append(append([]float64{}, c...), v))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+func (sw *Sweep) metrics(p *Point) []struct {
+	name string
+	s    Summary
+} {
+	return []struct {
+		name string
+		s    Summary
+	}{
+		{"offered_load", p.OfferedLoad},
+		{"efficiency", p.Efficiency},
+		{"throughput", p.Throughput},
+		{"delay", p.Delay},
+		{"collisions", p.Collisions},
+	}
+}
+
+// WriteCSV writes one row per point, with the mean and confidence interval of every metric
+func (sw *Sweep) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, 0)
+	for _, p := range sw.Params {
+		header = append(header, p.Name)
+	}
+	header = append(header, "runs")
+	for _, m := range sw.metrics(&Point{Batch: &Batch{}}) {
+		header = append(header, m.name, m.name+"_ci")
+	}
+	header = append(header, "predicted_efficiency", "deviation")
+	cw.Write(header)
+
+	for i := range sw.Points {
+		p := &sw.Points[i]
+		row := make([]string, 0, len(header))
+		for _, v := range p.Values {
+			row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		row = append(row, strconv.Itoa(len(p.Replications)))
+		for _, m := range sw.metrics(p) {
+			row = append(row, strconv.FormatFloat(m.s.Mean, 'g', 6, 64), strconv.FormatFloat(m.s.CI, 'g', 6, 64))
+		}
+		row = append(row, strconv.FormatFloat(p.Predicted, 'g', 6, 64), strconv.FormatFloat(p.Deviation, 'g', 6, 64))
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonPoint struct {
+	Params    map[string]float64 `json:"params"`
+	Runs      int                `json:"runs"`
+	Metrics   map[string]Summary `json:"metrics"`
+	Predicted float64            `json:"predicted_efficiency"`
+	Deviation float64            `json:"deviation"`
+}
+
+// WriteJSON writes the points as a JSON array
+func (sw *Sweep) WriteJSON(w io.Writer) error {
+	points := make([]jsonPoint, len(sw.Points))
+	for i := range sw.Points {
+		p := &sw.Points[i]
+		points[i] = jsonPoint{
+			Params:    make(map[string]float64),
+			Runs:      len(p.Replications),
+			Metrics:   make(map[string]Summary),
+			Predicted: p.Predicted,
+			Deviation: p.Deviation,
+		}
+		for j, v := range p.Values {
+			points[i].Params[sw.Params[j].Name] = v
+		}
+		for _, m := range sw.metrics(p) {
+			points[i].Metrics[m.name] = m.s
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(points)
+}
@@ -0,0 +1,118 @@
+package ethersim
+
+import "fmt"
+
+// FaultKind is a way in which a transceiver can misbehave
+type FaultKind int
+
+const (
+	// Transmits continuously without carrier sense
+	FaultBabble FaultKind = iota
+	// Jams the ether forever, as if its jam counter were stuck
+	FaultStuckJam
+	// Keeps transmitting through collisions
+	FaultIgnoreCollisions
+	// Neither transmits nor delivers, but still passes on what it hears
+	FaultSilent
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultBabble:
+		return "Babbling"
+	case FaultStuckJam:
+		return "Stuck Jam"
+	case FaultIgnoreCollisions:
+		return "Ignoring Collisions"
+	case FaultSilent:
+		return "Silent"
+	}
+	return "Unknown"
+}
+
+func ParseFaultKind(name string) (FaultKind, error) {
+	for k := FaultBabble; k <= FaultSilent; k++ {
+		if k.String() == name {
+			return k, nil
+		}
+	}
+	return FaultBabble, fmt.Errorf("unknown fault %q", name)
+}
+
+func (k FaultKind) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+func (k *FaultKind) UnmarshalText(text []byte) error {
+	var err error
+	*k, err = ParseFaultKind(string(text))
+	return err
+}
+
+// Fault makes a transceiver misbehave from tick Start until tick End
+type Fault struct {
+	Kind  FaultKind `json:"kind"`
+	Start int       `json:"start"`
+	End   int       `json:"end"` // -1 for never
+}
+
+func (f Fault) activeAt(tick int) bool {
+	return tick >= f.Start && (f.End < 0 || tick < f.End)
+}
+
+// InjectFault schedules a fault on the transceiver
+func (n *NetworkNode) InjectFault(f Fault) {
+	n.faults = append(n.faults, f)
+}
+
+// ClearFault ends every fault of the given kind, including scheduled ones
+func (n *NetworkNode) ClearFault(k FaultKind) {
+	faults := n.faults[:0]
+	for _, f := range n.faults {
+		if f.Kind != k {
+			faults = append(faults, f)
+		}
+	}
+	n.faults = faults
+}
+
+func (n *NetworkNode) Faults() []Fault { return n.faults }
+
+// Faulty reports whether a fault of the given kind is active on the current tick
+func (n *NetworkNode) Faulty(k FaultKind) bool {
+	for _, f := range n.faults {
+		if f.Kind == k && f.activeAt(n.sim.ticks) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveFault returns the kind of the first active fault, if any
+func (n *NetworkNode) ActiveFault() (FaultKind, bool) {
+	for _, f := range n.faults {
+		if f.activeAt(n.sim.ticks) {
+			return f.Kind, true
+		}
+	}
+	return FaultBabble, false
+}
+
+// tickFault sends msg on every edge regardless of what is on the ether
+func (n *NetworkNode) tickFault(msg NetworkMsg) {
+	n.transmitting = false
+	for _, edge := range n.edges {
+		edge.OnMsg(msg.Copy(), n)
+	}
+	n.incMessages = n.incMessages[:0]
+}
+
+// tickSilent passes on what the transceiver hears like a passive tap
+func (n *NetworkNode) tickSilent() {
+	n.transmitting = false
+	for _, edge := range n.edges {
+		for _, msg := range n.incMessages {
+			if !edge.connects(msg.from) {
+				edge.OnMsg(msg.m.Copy(), n)
+			}
+		}
+	}
+	n.incMessages = n.incMessages[:0]
+}
@@ -0,0 +1,271 @@
+package ethersim_test
+
+import (
+	"encoding"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// randomTree builds a random tree of transceivers with random edge weights,
+// most of them with a device and some of them repeaters, or switches on
+// full-duplex edges if switches is set. Some trees hang off a bus segment
+// tapped at random. With loops set, switches replace repeaters and are more
+// common, and extra links join them to each other, closing loops that only the
+// spanning tree protocol can break.
+func randomTree(t *testing.T, s *ethersim.Simulation, r *rand.Rand, nodes int, switches bool, loops bool) {
+	topology := ethersim.Topology{Nodes: make([]ethersim.TopologyNode, nodes)}
+	topology.Nodes[0] = ethersim.TopologyNode{Parent: -1, Device: 1 + r.IntN(4)}
+	for i := 1; i < nodes; i++ {
+		topology.Nodes[i] = ethersim.TopologyNode{Parent: r.IntN(i), Weight: 1 + r.IntN(8)}
+		topology.Nodes[i].Duplex = topology.Nodes[topology.Nodes[i].Parent].Switch
+		if !loops && r.IntN(6) == 0 {
+			topology.Nodes[i].Repeater = true
+			topology.Nodes[i].Delay = r.IntN(4)
+		} else if switches && r.IntN(6) == 0 || loops && r.IntN(2) == 0 {
+			topology.Nodes[i].Switch = true
+			topology.Nodes[i].Duplex = true
+		} else if r.IntN(5) > 0 {
+			topology.Nodes[i].Device = 1 + r.IntN(4)
+		}
+	}
+	// Over a half-duplex cable a device can garble a frame its transceiver is
+	// forwarding to it, which the checker rightly reports
+	for i := range topology.Nodes {
+		topology.Nodes[i].DeviceDuplex = true
+	}
+	if r.IntN(2) == 0 {
+		root := 0
+		bus := ethersim.TopologyBus{Weight: 4 + r.IntN(32)}
+		bus.Taps = append(bus.Taps, ethersim.TopologyTap{Position: r.IntN(bus.Weight + 1), Node: &root})
+		for pos := range bus.Weight + 1 {
+			if pos != bus.Taps[0].Position && r.IntN(6) == 0 {
+				bus.Taps = append(bus.Taps, ethersim.TopologyTap{Position: pos, Device: 1 + r.IntN(4), DeviceDuplex: true})
+			}
+		}
+		topology.Buses = append(topology.Buses, bus)
+	}
+	// Loops only run through switches, as BPDUs can be held up for longer than
+	// the maximum age on a busy shared segment
+	bridged := func(a, b int) bool {
+		path := make(map[int]bool)
+		for n := a; n >= 0; n = topology.Nodes[n].Parent {
+			path[n] = true
+		}
+		for ; !path[b]; b = topology.Nodes[b].Parent {
+			if !topology.Nodes[b].Switch {
+				return false
+			}
+		}
+		for n := a; n != b; n = topology.Nodes[n].Parent {
+			if !topology.Nodes[n].Switch {
+				return false
+			}
+		}
+		return topology.Nodes[b].Switch
+	}
+	for i := range nodes {
+		if !loops || !topology.Nodes[i].Switch {
+			continue
+		}
+		for range 1 + r.IntN(2) {
+			// Nodes already joined to the switch by an edge cannot be linked again
+			to := r.IntN(nodes)
+			joined := to == i || !bridged(i, to) || topology.Nodes[i].Parent == to || topology.Nodes[to].Parent == i
+			for _, l := range topology.Links {
+				joined = joined || (l.From == i && l.To == to) || (l.From == to && l.To == i)
+			}
+			if !joined {
+				topology.Links = append(topology.Links, ethersim.TopologyLink{From: i, To: to, Weight: 1 + r.IntN(8), Duplex: true})
+			}
+		}
+	}
+	build(t, s, topology)
+}
+
+// FuzzRandomTraffic runs random traffic over random trees and checks that the
+// simulation never panics, that every queued message is eventually delivered
+// or reported as dropped, and that this takes a bounded number of ticks.
+func FuzzRandomTraffic(f *testing.F) {
+	for seed := range uint64(16) {
+		f.Add(seed, uint8(2+seed%10), uint8(seed%4), uint8(8))
+	}
+
+	f.Fuzz(func(t *testing.T, seed uint64, nodes uint8, protocol uint8, messages uint8) {
+		r := rand.New(rand.NewPCG(seed, 0))
+		s := ethersim.MakeSeededSimulation(seed)
+		p := ethersim.Protocol(protocol % uint8(ethersim.ProtocolCSMACA+1))
+		// Switches only retry frames lost on shared segments under CSMA/CD
+		switches := p == ethersim.ProtocolCSMACD
+		loops := switches && r.IntN(2) == 0
+		format := ethersim.FrameFormat(r.IntN(int(ethersim.FormatXerox) + 1))
+		if format != ethersim.FormatAbstract && r.IntN(2) == 0 {
+			s.SetSignalling(ethersim.SignalManchester)
+		}
+		randomTree(t, s, r, 2+int(nodes%24), switches, loops)
+		devices := s.Devices()
+		if len(devices) < 2 {
+			t.Skip("fewer than two devices")
+		}
+		// Some Ethernet II devices talk over IPv4, resolving each other with ARP
+		ip := format == ethersim.FormatEthernetII && r.IntN(2) == 0
+		if ip {
+			if err := s.AssignIPs(netip.MustParsePrefix("10.0.0.0/16")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Frames must outlast the round trip for collisions to be detected
+		config := ethersim.Config{FrameTicks: max(50, 2*s.MaxPropagationDelay()+10)}
+		if loops {
+			// Hellos far apart, as in real networks, so that they do not keep
+			// holding up transceivers that back off whenever the medium is busy
+			config.HelloTicks = 40 * config.FrameTicks
+			config.MaxAgeTicks = 200 * config.FrameTicks
+			config.ForwardDelayTicks = 100 * config.FrameTicks
+		}
+		s.SetConfig(config)
+		s.SetProtocol(p)
+		s.SetSpanningTree(loops)
+		s.EnableChecker().SetViolationCb(func(v ethersim.Violation) { t.Error(v) })
+
+		pending := make(map[string]bool)
+		resolve := func(id int, msg ethersim.NetworkMsg) { delete(pending, msg.Value()) }
+		s.SetDeviceReceiveMsgCb(resolve)
+		s.SetTransceiverDropMsgCb(resolve)
+		s.SetDeviceDropMsgCb(resolve)
+		s.SetSwitchDropMsgCb(resolve)
+		s.SetTransceiverReceiveErrorCb(resolve)
+		s.SetDeviceUnreachableCb(func(id int, p *ethersim.IPv4Packet) { delete(pending, string(p.Payload)) })
+
+		// Light load: messages are queued at random ticks, well apart on average
+		spread := int(messages) * 4 * s.Config().FrameTicks
+		// Traffic starts once the spanning tree has settled
+		start := 0
+		if loops {
+			start = s.Config().MaxAgeTicks + 2*s.Config().ForwardDelayTicks
+			spread += start
+		}
+		queueAt := make(map[int][]int)
+		for i := range int(messages) {
+			tick := start + r.IntN(spread-start+1)
+			queueAt[tick] = append(queueAt[tick], i)
+		}
+
+		limit := spread + 200*s.Config().FrameTicks*max(1, int(messages))
+		for s.Ticks() <= spread || len(pending) > 0 {
+			if s.Ticks() > limit {
+				t.Fatalf("%v messages still pending after %v ticks", len(pending), limit)
+			}
+			for _, i := range queueAt[s.Ticks()] {
+				from := devices[r.IntN(len(devices))]
+				to := devices[r.IntN(len(devices))]
+				for to == from {
+					to = devices[r.IntN(len(devices))]
+				}
+				val := fmt.Sprint(i)
+				pending[val] = true
+				switch {
+				case ip:
+					if err := from.SendIP(to.IP().Addr(), ethersim.IPProtocolExperimental, []byte(val)); err != nil {
+						t.Fatal(err)
+					}
+				case format == ethersim.FormatEthernetII:
+					from.QueueMessage(from.MakeFrame(to.MAC(), ethersim.EtherTypeIPv4, []byte(val)))
+				case format == ethersim.FormatXerox:
+					from.QueueMessage(&ethersim.XeroxFrame{V: true, Dst: ethersim.XeroxAddressOf(to.Id()), Src: ethersim.XeroxAddressOf(from.Id()), Payload: []byte(val)})
+				default:
+					from.QueueMessage(&ethersim.BaseMsg{V: true, Msg: val, Sender: from.Id(), To: to.Id()})
+				}
+			}
+			s.Tick()
+
+			for _, n := range s.Nodes() {
+				n.SendingTo()
+				n.SendingValue()
+			}
+		}
+	})
+}
+
+// FuzzFrame decodes arbitrary bytes as Ethernet II frames, Xerox packets and
+// the IPv4, ARP, ICMP echo, transport and UDP packets frames carry, and checks that every frame that
+// decodes is encoded back to the same frame
+func FuzzFrame(f *testing.F) {
+	for _, frame := range []encoding.BinaryMarshaler{
+		&ethersim.Frame{V: true, Dst: ethersim.Broadcast, Src: ethersim.MACOf(1), EtherType: ethersim.EtherTypeARP, Payload: []byte("who has")},
+		&ethersim.Frame{V: true, Dst: ethersim.MACOf(2), Src: ethersim.MACOf(3), Tag: ethersim.VLANTag{ID: 10, Priority: 5}, EtherType: ethersim.EtherTypeIPv4, Payload: make([]byte, 1500)},
+		&ethersim.Frame{V: true, Dst: ethersim.MACOf(2), Src: ethersim.MACOf(3), Tag: ethersim.VLANTag{ID: 10, DEI: true}, EtherType: ethersim.EtherTypeIPv4, Payload: []byte("drop eligible")},
+		&ethersim.Frame{V: true, Dst: ethersim.MACOf(2), Src: ethersim.MACOf(3), Tag: ethersim.VLANTag{Priority: 6}, EtherType: ethersim.EtherTypeIPv4, Payload: []byte("priority tagged")},
+		&ethersim.XeroxFrame{V: true, Dst: ethersim.XeroxBroadcast, Src: ethersim.XeroxAddressOf(4), Type: ethersim.XeroxTypePUP, Payload: []byte("pup")},
+		&ethersim.IPv4Packet{ID: 7, TTL: 64, Protocol: ethersim.IPProtocolExperimental, Src: netip.MustParseAddr("10.0.0.1"), Dst: netip.MustParseAddr("10.0.0.2"), Payload: []byte("datagram")},
+		&ethersim.ARPPacket{Op: ethersim.ARPRequest, SenderMAC: ethersim.MACOf(1), SenderIP: netip.MustParseAddr("10.0.0.1"), TargetIP: netip.MustParseAddr("10.0.0.2")},
+		&ethersim.ICMPEcho{Type: ethersim.ICMPEchoRequest, ID: 1, Seq: 3, Data: []byte("ethersim")},
+		&ethersim.Segment{Conn: 1, Selective: true, Seq: 9, Data: []byte("segment")},
+		&ethersim.Segment{Conn: 1, Ack: true, Seq: 9, Next: 4},
+		&ethersim.UDPDatagram{SrcPort: 49152, DstPort: 7, Data: []byte("datagram")},
+	} {
+		b, err := frame.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var frame ethersim.Frame
+		if err := frame.UnmarshalBinary(b); err == nil {
+			if frame.Src.Handle() >= 0 && ethersim.MACOf(frame.Src.Handle()) != frame.Src {
+				t.Fatalf("source %v has handle %v", frame.Src, frame.Src.Handle())
+			}
+			roundTrip(t, &frame, &ethersim.Frame{})
+		}
+		var packet ethersim.XeroxFrame
+		if err := packet.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &packet, &ethersim.XeroxFrame{})
+		}
+		var ip ethersim.IPv4Packet
+		if err := ip.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &ip, &ethersim.IPv4Packet{})
+		}
+		var arp ethersim.ARPPacket
+		if err := arp.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &arp, &ethersim.ARPPacket{})
+		}
+		var echo ethersim.ICMPEcho
+		if err := echo.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &echo, &ethersim.ICMPEcho{})
+		}
+		var seg ethersim.Segment
+		if err := seg.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &seg, &ethersim.Segment{})
+		}
+		var udp ethersim.UDPDatagram
+		if err := udp.UnmarshalBinary(b); err == nil {
+			roundTrip(t, &udp, &ethersim.UDPDatagram{})
+		}
+	})
+}
+
+type wireFormat interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// roundTrip checks that a decoded frame decodes to the same frame again
+// once encoded, unless it cannot be encoded
+func roundTrip(t *testing.T, frame wireFormat, again wireFormat) {
+	enc, err := frame.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if err := again.UnmarshalBinary(enc); err != nil {
+		t.Fatalf("re-encoded frame does not decode: %v", err)
+	}
+	if !reflect.DeepEqual(frame, again) {
+		t.Fatalf("frame changed from %+v to %+v", frame, again)
+	}
+}
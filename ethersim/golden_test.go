@@ -0,0 +1,135 @@
+package ethersim_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden trace files")
+
+// trace records every event of a simulation, one line per event
+func trace(s *ethersim.Simulation) *strings.Builder {
+	var b strings.Builder
+	msgEvent := func(kind string) ethersim.MsgEventCb {
+		return func(id int, msg ethersim.NetworkMsg) {
+			fmt.Fprintf(&b, "%6v %v %v Msg{val: %v, to: %v, from: %v}\n", s.Ticks(), kind, id, msg.Value(), msg.Dest(), msg.From())
+		}
+	}
+	s.SetTransceiverBeginTransmitCb(msgEvent("T begin"))
+	s.SetTransceiverEndTransmitCb(msgEvent("T end"))
+	s.SetTransceiverDropMsgCb(msgEvent("T drop"))
+	s.SetTransceiverJamCb(func(id int) { fmt.Fprintf(&b, "%6v T jam %v\n", s.Ticks(), id) })
+	s.SetDeviceQueueMsgCb(msgEvent("D queue"))
+	s.SetDeviceDropMsgCb(msgEvent("D drop"))
+	s.SetDeviceReceiveMsgCb(msgEvent("D recv"))
+	return &b
+}
+
+func build(t *testing.T, s *ethersim.Simulation, topology ethersim.Topology) {
+	t.Helper()
+	if _, err := topology.Build(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var goldenScenarios = []struct {
+	name  string
+	ticks int
+	setup func(t *testing.T, s *ethersim.Simulation)
+}{
+	{
+		// Both stations start sending at once and must collide, jam and back off
+		name:  "collision",
+		ticks: 1000,
+		setup: func(t *testing.T, s *ethersim.Simulation) {
+			build(t, s, ethersim.LineTopology(2, 4))
+			d := s.Devices()
+			d[0].QueueMessage(&ethersim.BaseMsg{V: true, Msg: "a", Sender: d[0].Id(), To: d[1].Id()})
+			d[1].QueueMessage(&ethersim.BaseMsg{V: true, Msg: "b", Sender: d[1].Id(), To: d[0].Id()})
+		},
+	},
+	{
+		// The five transceiver line built by main.go under random traffic
+		name:  "line",
+		ticks: 5000,
+		setup: func(t *testing.T, s *ethersim.Simulation) {
+			build(t, s, ethersim.LineTopology(5, 4))
+			ethersim.MakeTraffic(s, 0.002)
+		},
+	},
+	{
+		// Every station of a star has a backlog of messages from the start
+		name:  "saturated-star",
+		ticks: 8000,
+		setup: func(t *testing.T, s *ethersim.Simulation) {
+			build(t, s, ethersim.StarTopology(6, 4))
+			d := s.Devices()
+			for i, dev := range d {
+				for j := range 4 {
+					dev.QueueMessage(&ethersim.BaseMsg{V: true, Msg: fmt.Sprint(j), Sender: dev.Id(), To: d[(i+1)%len(d)].Id()})
+				}
+			}
+		},
+	},
+}
+
+// TestGolden compares the event traces of canonical scenarios with the
+// checked-in files in testdata. Run with -update to regenerate them.
+func TestGolden(t *testing.T) {
+	for _, sc := range goldenScenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			s := ethersim.MakeSeededSimulation(1)
+			b := trace(s)
+			checker := s.EnableChecker()
+			sc.setup(t, s)
+			for range sc.ticks {
+				s.Tick()
+			}
+			for _, v := range checker.Violations() {
+				t.Error(v)
+			}
+			got := b.String()
+
+			path := filepath.Join("testdata", sc.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("trace differs from %v:\n%v", path, firstDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// firstDiff describes the first line at which two traces differ
+func firstDiff(want, got string) string {
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+	for i := range max(len(wl), len(gl)) {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %v:\n  want %q\n   got %q", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package ethersim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// IPProtocol names the protocol an IPv4 packet carries
+type IPProtocol uint8
+
+const (
+	IPProtocolICMP         IPProtocol = 1
+	IPProtocolUDP          IPProtocol = 17
+	IPProtocolExperimental IPProtocol = 253 // Reserved for experimentation by RFC 3692
+	IPProtocolTransport    IPProtocol = 254 // The reliable transport of devices, on the second number RFC 3692 reserves
+)
+
+func (p IPProtocol) String() string {
+	switch p {
+	case IPProtocolICMP:
+		return "ICMP"
+	case IPProtocolUDP:
+		return "UDP"
+	case IPProtocolExperimental:
+		return "experimental"
+	case IPProtocolTransport:
+		return "transport"
+	}
+	return fmt.Sprintf("%d", uint8(p))
+}
+
+const (
+	ipv4HeaderBytes = 20
+	ipv4DefaultTTL  = 64
+)
+
+// IPv4Packet is an IPv4 packet without options
+type IPv4Packet struct {
+	ID       uint16
+	TTL      uint8
+	Protocol IPProtocol
+	Src      netip.Addr
+	Dst      netip.Addr
+	Payload  []byte
+}
+
+// MarshalBinary encodes the packet with its header checksum
+func (p *IPv4Packet) MarshalBinary() ([]byte, error) {
+	if !p.Src.Is4() || !p.Dst.Is4() {
+		return nil, fmt.Errorf("IPv4 packet from %v to %v", p.Src, p.Dst)
+	}
+	if ipv4HeaderBytes+len(p.Payload) > MaxPayloadBytes {
+		return nil, fmt.Errorf("payload of %v bytes exceeds %v", len(p.Payload), MaxPayloadBytes-ipv4HeaderBytes)
+	}
+	b := make([]byte, ipv4HeaderBytes, ipv4HeaderBytes+len(p.Payload))
+	b[0] = 4<<4 | ipv4HeaderBytes/4
+	binary.BigEndian.PutUint16(b[2:], uint16(ipv4HeaderBytes+len(p.Payload)))
+	binary.BigEndian.PutUint16(b[4:], p.ID)
+	b[8] = p.TTL
+	b[9] = byte(p.Protocol)
+	src, dst := p.Src.As4(), p.Dst.As4()
+	copy(b[12:], src[:])
+	copy(b[16:], dst[:])
+	binary.BigEndian.PutUint16(b[10:], ^onesSum(b))
+	return append(b, p.Payload...), nil
+}
+
+// UnmarshalBinary decodes a packet, ignoring its options and any bytes past
+// its total length such as the padding of a short frame. Fragments are not
+// reassembled, so they are refused.
+func (p *IPv4Packet) UnmarshalBinary(b []byte) error {
+	if len(b) < ipv4HeaderBytes {
+		return fmt.Errorf("IPv4 packet of %v bytes is shorter than its header", len(b))
+	}
+	if b[0]>>4 != 4 {
+		return fmt.Errorf("IP version %v", b[0]>>4)
+	}
+	ihl := int(b[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(b[2:]))
+	if ihl < ipv4HeaderBytes || total < ihl || total > len(b) {
+		return fmt.Errorf("IPv4 header of %v bytes and total length %v in %v bytes", ihl, total, len(b))
+	}
+	if onesSum(b[:ihl]) != 0xffff {
+		return errors.New("bad IPv4 header checksum")
+	}
+	if binary.BigEndian.Uint16(b[6:])&0x3fff != 0 {
+		return errors.New("IPv4 fragment")
+	}
+	*p = IPv4Packet{
+		ID:       binary.BigEndian.Uint16(b[4:]),
+		TTL:      b[8],
+		Protocol: IPProtocol(b[9]),
+		Src:      netip.AddrFrom4([4]byte(b[12:16])),
+		Dst:      netip.AddrFrom4([4]byte(b[16:20])),
+		Payload:  append([]byte(nil), b[ihl:total]...),
+	}
+	return nil
+}
+
+// onesSum is the ones' complement sum of b as big-endian 16-bit words, the
+// Internet checksum before it is complemented
+func onesSum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return uint16(sum)
+}
+
+// ARPOp is the operation of an ARP packet
+type ARPOp uint16
+
+const (
+	ARPRequest ARPOp = 1
+	ARPReply   ARPOp = 2
+)
+
+func (op ARPOp) String() string {
+	switch op {
+	case ARPRequest:
+		return "request"
+	case ARPReply:
+		return "reply"
+	}
+	return fmt.Sprintf("op %d", uint16(op))
+}
+
+const arpPacketBytes = 28
+
+// ARPPacket resolves an IPv4 address to the MAC address of the device that has it
+type ARPPacket struct {
+	Op        ARPOp
+	SenderMAC MAC
+	SenderIP  netip.Addr
+	TargetMAC MAC // Unknown, and left zero, in requests
+	TargetIP  netip.Addr
+}
+
+func (p *ARPPacket) String() string {
+	if p.Op == ARPRequest {
+		return fmt.Sprintf("ARP who has %v? Tell %v", p.TargetIP, p.SenderIP)
+	}
+	return fmt.Sprintf("ARP %v is at %v", p.SenderIP, p.SenderMAC)
+}
+
+// MarshalBinary encodes the packet for Ethernet hardware and IPv4 addresses
+func (p *ARPPacket) MarshalBinary() ([]byte, error) {
+	if !p.SenderIP.Is4() || !p.TargetIP.Is4() {
+		return nil, fmt.Errorf("ARP for %v from %v", p.TargetIP, p.SenderIP)
+	}
+	b := make([]byte, arpPacketBytes)
+	binary.BigEndian.PutUint16(b[0:], 1) // Ethernet
+	binary.BigEndian.PutUint16(b[2:], uint16(EtherTypeIPv4))
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:], uint16(p.Op))
+	sip, tip := p.SenderIP.As4(), p.TargetIP.As4()
+	copy(b[8:], p.SenderMAC[:])
+	copy(b[14:], sip[:])
+	copy(b[18:], p.TargetMAC[:])
+	copy(b[24:], tip[:])
+	return b, nil
+}
+
+// UnmarshalBinary decodes a packet, ignoring the padding of a short frame
+func (p *ARPPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < arpPacketBytes {
+		return fmt.Errorf("ARP packet of %v bytes", len(b))
+	}
+	if binary.BigEndian.Uint16(b[0:]) != 1 || EtherType(binary.BigEndian.Uint16(b[2:])) != EtherTypeIPv4 || b[4] != 6 || b[5] != 4 {
+		return errors.New("ARP packet is not for Ethernet and IPv4")
+	}
+	*p = ARPPacket{
+		Op:        ARPOp(binary.BigEndian.Uint16(b[6:])),
+		SenderMAC: MAC(b[8:14]),
+		SenderIP:  netip.AddrFrom4([4]byte(b[14:18])),
+		TargetMAC: MAC(b[18:24]),
+		TargetIP:  netip.AddrFrom4([4]byte(b[24:28])),
+	}
+	return nil
+}
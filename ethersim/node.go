@@ -1,11 +1,10 @@
 package ethersim
 
 import (
-	"math/rand/v2"
+	"fmt"
+	"slices"
 )
 
-var nodeid int = 0
-
 type incMessage struct {
 	m    NetworkMsg
 	from Network
@@ -14,7 +13,7 @@ type incMessage struct {
 type NetworkNode struct {
 	sim          *Simulation
 	id           int
-	edges        []*NetworkEdge
+	edges        []link
 	deviceEdge   *NetworkEdge
 	incMessages  []incMessage
 	outMessages  []NetworkMsg
@@ -27,40 +26,101 @@ type NetworkNode struct {
 	seenReset    bool
 	hasSent      bool
 	transmitRem  int
+	txStart      int // Tick the current transmission began
+	attempts     int
+	rx           decoder
+	resv         reservation
+	ca           avoidance
+	faults       []Fault
 }
 
 func MakeNetworkNode(s *Simulation) *NetworkNode {
 	n := &NetworkNode{
 		sim:          s,
-		id:           nodeid,
-		edges:        make([]*NetworkEdge, 0),
+		id:           s.nextNodeId,
+		edges:        make([]link, 0),
 		deviceEdge:   nil,
 		resetting:    0,
 		transmitting: false,
 		resetTicks:   0,
-		timeoutRange: 20,
+		timeoutRange: s.config.TimeoutRange,
 		seenReset:    false,
 		hasSent:      false,
+		resv:         noReservation,
+		ca:           makeAvoidance(),
 	}
 	s.register(n)
-	nodeid++
+	s.nodes = append(s.nodes, n)
+	s.nextNodeId++
 	return n
 }
 
 func (n *NetworkNode) CreateNode(weight int) (*NetworkNode, *NetworkEdge) {
 	nn := MakeNetworkNode(n.sim)
-	edge := makeNetworkEdge(n.sim, n, nn, weight)
-	n.edges = append(n.edges, edge)
-	nn.edges = append(nn.edges, edge)
-	return nn, edge
+	return nn, connect(n.sim, n, nn, weight)
+}
+
+// connect joins two junctions with an edge
+func connect(s *Simulation, j1 junction, j2 junction, weight int) *NetworkEdge {
+	edge := makeNetworkEdge(s, j1, j2, weight)
+	j1.attach(edge)
+	j2.attach(edge)
+	return edge
 }
 
-func (n *NetworkNode) Id() int { return n.id }
+// Connect joins two transceivers, repeaters or switches that may already be
+// linked some other way, closing a loop. They must not share an edge yet.
+func (s *Simulation) Connect(a Network, b Network, weight int) (*NetworkEdge, error) {
+	j1, ok1 := a.(junction)
+	j2, ok2 := b.(junction)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("only transceivers, repeaters and switches can be connected")
+	}
+	if j1 == j2 {
+		return nil, fmt.Errorf("cannot connect a component to itself")
+	}
+	if weight <= 0 {
+		return nil, fmt.Errorf("edge weight must be positive")
+	}
+	// Messages are told apart by the component they come from, not the edge
+	for _, l := range j1.links() {
+		if e, ok := l.(*NetworkEdge); ok && e.connects(j2) {
+			return nil, fmt.Errorf("already joined by E%v", e.id)
+		}
+	}
+	return connect(s, j1, j2, weight), nil
+}
+
+func (n *NetworkNode) Id() int        { return n.id }
+func (n *NetworkNode) attach(l link)  { n.edges = append(n.edges, l) }
+func (n *NetworkNode) links() []link  { return n.edges }
+func (n *NetworkNode) passDelay() int { return 0 }
+func (n *NetworkNode) detach(l link) {
+	n.edges = slices.DeleteFunc(n.edges, func(e link) bool { return e == l })
+}
 
 // Network Component Interface
 // Distribute messages to edges after edges have ticked
 func (n *NetworkNode) TickFalling() bool { return true }
 func (n *NetworkNode) Tick() {
+	if n.Faulty(FaultStuckJam) {
+		n.tickFault(&JamMsg{})
+	} else if n.Faulty(FaultBabble) {
+		n.tickFault(&BaseMsg{V: true, Msg: "babble", Sender: n.deviceId(), To: -1})
+	} else if n.Faulty(FaultSilent) {
+		n.tickSilent()
+	} else if n.fullDuplex() {
+		n.tickFullDuplex()
+	} else if n.sim.protocol.reserves() {
+		n.tickReservation()
+	} else if n.sim.protocol == ProtocolCSMACA {
+		n.tickCSMACA()
+	} else {
+		n.tickCSMACD()
+	}
+}
+
+func (n *NetworkNode) tickCSMACD() {
 	hasNonJam := false
 	hasJam := false
 	for _, m := range n.incMessages {
@@ -68,20 +128,26 @@ func (n *NetworkNode) Tick() {
 		hasJam = hasJam || m.m.IsJam()
 	}
 
+	// A transceiver ignoring collisions transmits straight through them
+	ignore := n.transmitting && n.Faulty(FaultIgnoreCollisions)
+	if ignore {
+		hasJam = false
+	}
+
 	if hasJam {
 		if n.transmitting {
-			n.timeoutRange *= 2
+			n.collided()
 		}
 
 		n.transmitting = false
-	} else if len(n.incMessages) > 0 && n.transmitting {
+	} else if len(n.incMessages) > 0 && n.transmitting && !ignore {
 		if !n.seenReset {
 			n.sim.onTransceiverJam(n.id)
 			n.seenReset = true
 			if n.transmitting {
-				n.timeoutRange *= 2
+				n.collided()
 			}
-			n.resetTicks = numResetTicks
+			n.resetTicks = n.sim.config.JamTicks
 		}
 		n.transmitting = false
 	}
@@ -96,8 +162,9 @@ func (n *NetworkNode) Tick() {
 		n.timeout--
 	} else if n.timeout == 0 && len(n.outMessages) > 0 && !n.transmitting {
 		n.transmitting = true
-		n.transmitRem = 50
-		n.sim.onTransceiverBeginTransmit(n.id, n.outMessages[0].Copy())
+		n.transmitRem = n.sim.config.FrameTicks
+		n.txStart = n.sim.ticks
+		n.sim.onTransceiverBeginTransmit(n.id, n.outMessages[0])
 	}
 
 	if n.resetTicks == 0 {
@@ -119,16 +186,15 @@ func (n *NetworkNode) Tick() {
 				if !msg.m.IsJam() {
 					continue
 				}
-				if edge.n1 != msg.from && edge.n2 != msg.from {
+				if !edge.connects(msg.from) {
 					edge.OnMsg(&JamMsg{}, n)
 				}
 			}
 		} else if n.transmitting {
-			msg := n.outMessages[0].Copy()
-			edge.OnMsg(msg, n)
+			edge.OnMsg(n.sending(), n)
 		} else {
 			for _, msg := range n.incMessages {
-				if edge.n1 != msg.from && edge.n2 != msg.from {
+				if !edge.connects(msg.from) {
 					edge.OnMsg(msg.m.Copy(), n)
 				}
 			}
@@ -138,21 +204,65 @@ func (n *NetworkNode) Tick() {
 	if n.transmitRem <= 0 && n.transmitting {
 		n.transmitting = false
 		n.timeoutRange = int(float32(n.timeoutRange)*0.9) + 2
+		n.attempts = 0
 		n.randomizeTimeout()
-		n.sim.onTransceiverEndTransmit(n.id, n.outMessages[0].Copy())
+		n.sim.onTransceiverEndTransmit(n.id, n.outMessages[0])
 		n.outMessages = n.outMessages[1:]
 	}
 
-	if n.resetTicks == 0 && !n.transmitting && len(n.incMessages) == 1 {
-		msg := n.incMessages[0]
-		if n.deviceEdge != nil && msg.m.Dest() == n.deviceEdge.n2.Id() && msg.m.IsLast() {
-			n.deviceEdge.OnMsg(msg.m.Copy(), n)
-		}
+	if n.resetTicks == 0 && !n.transmitting {
+		n.deliverIncoming()
 	}
 
 	n.incMessages = n.incMessages[:0]
 }
 
+// collided doubles the backoff range after a transmission was interrupted and
+// gives up on the message once the attempt limit is reached. Collisions heard
+// more than a slot time after the transmission began are late collisions.
+func (n *NetworkNode) collided() {
+	if n.sim.ticks-n.txStart > n.sim.config.SlotTicks {
+		n.sim.onTransceiverLateCollision(n.id, n.outMessages[0])
+	}
+	n.timeoutRange = min(2*n.timeoutRange, n.sim.config.MaxTimeoutRange)
+	n.attempts++
+	if n.attempts >= n.sim.config.AttemptLimit {
+		n.attempts = 0
+		msg := n.outMessages[0]
+		n.outMessages = n.outMessages[1:]
+		n.sim.onTransceiverDropMsg(n.id, msg)
+	}
+}
+
+// deliverIncoming passes a lone, complete and uncorrupted message addressed
+// to this transceiver's device, or broadcast, on to it
+func (n *NetworkNode) deliverIncoming() {
+	if len(n.incMessages) > 1 {
+		n.rx.spoil()
+	}
+	if len(n.incMessages) != 1 {
+		return
+	}
+	msg := n.receive(n.incMessages[0].m)
+	if n.forDevice(msg) && msg.IsLast() && msg.Valid() {
+		n.deviceEdge.OnMsg(msg.Copy(), n)
+	}
+}
+
+// receive decodes the signals of a frame, returning the frame once its last
+// signal arrives. Frames for the device that cannot be decoded are reported.
+func (n *NetworkNode) receive(msg NetworkMsg) NetworkMsg {
+	sig, ok := msg.(*Signal)
+	if !ok {
+		return msg
+	}
+	msg, err := n.rx.add(sig)
+	if err != nil && msg.Dest() == n.deviceId() {
+		n.sim.onTransceiverReceiveError(n.Id(), msg, err)
+	}
+	return msg
+}
+
 // OnMsg expects to be called during the rising tick
 func (n *NetworkNode) OnMsg(msg NetworkMsg, from Network) {
 	if n.deviceEdge != nil && from == n.deviceEdge.n2 {
@@ -188,26 +298,32 @@ func (n *NetworkNode) isResetting(from Network) bool {
 }
 
 func (n *NetworkNode) IsResetting() bool {
-	return n.seenReset
+	return n.seenReset || n.Faulty(FaultStuckJam)
 }
 func (n *NetworkNode) randomizeTimeout() {
-	n.timeout = rand.IntN(n.timeoutRange) + 1
+	n.timeout = n.sim.rand.IntN(n.timeoutRange) + 1
 	n.timeoutFrom = n.timeout
 }
 
+// sending returns the part of the frame at the head of the queue that goes
+// out in this tick of its transmission
+func (n *NetworkNode) sending() NetworkMsg {
+	return n.sim.encode(n.outMessages[0].Copy(), n.sim.config.FrameTicks-1-n.transmitRem)
+}
+
 func (n *NetworkNode) TimeoutRange() int    { return n.timeoutRange }
 func (n *NetworkNode) TimeoutFrom() int     { return n.timeoutFrom }
 func (n *NetworkNode) Timeout() int         { return n.timeout }
 func (n *NetworkNode) NQueued() int         { return len(n.outMessages) }
 func (n *NetworkNode) IsTransmitting() bool { return n.transmitting }
 func (n *NetworkNode) SendingTo() int {
-	if n.transmitting {
+	if n.transmitting && len(n.outMessages) > 0 {
 		return n.outMessages[0].Dest()
 	}
 	return -1
 }
 func (n *NetworkNode) SendingValue() string {
-	if n.transmitting {
+	if n.transmitting && len(n.outMessages) > 0 {
 		return n.outMessages[0].Value()
 	}
 	return "-"
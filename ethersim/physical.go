@@ -0,0 +1,94 @@
+package ethersim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const speedOfLight = 299792458.0 // Metres per second
+
+// Physical relates ticks to time and edge stages to cable length. The zero
+// value leaves the simulation in unitless ticks.
+type Physical struct {
+	BitRate        float64 `json:"bit_rate"`                  // Bits per second
+	TickDuration   float64 `json:"tick_duration,omitempty"`   // Seconds per tick, one bit time if unset
+	VelocityFactor float64 `json:"velocity_factor,omitempty"` // Signal speed in the cable as a fraction of c
+}
+
+// PhysicalPresets holds the physical layers of the original Ether and of 802.3
+var PhysicalPresets = map[string]Physical{
+	"xerox":   {BitRate: 2.94e6, VelocityFactor: 0.77},
+	"10base5": {BitRate: 10e6, VelocityFactor: 0.77},
+}
+
+func PhysicalPreset(name string) (Physical, error) {
+	if p, ok := PhysicalPresets[name]; ok {
+		return p.withDefaults(), nil
+	}
+	names := make([]string, 0, len(PhysicalPresets))
+	for n := range PhysicalPresets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Physical{}, fmt.Errorf("unknown physical layer %q, expected one of %v", name, names)
+}
+
+func (p Physical) Enabled() bool { return p.BitRate > 0 }
+
+func (p Physical) withDefaults() Physical {
+	if !p.Enabled() {
+		return Physical{}
+	}
+	if p.TickDuration <= 0 {
+		p.TickDuration = 1 / p.BitRate
+	}
+	if p.VelocityFactor <= 0 {
+		p.VelocityFactor = 0.77
+	}
+	return p
+}
+
+// StageLength is the distance in metres a signal travels in one tick
+func (p Physical) StageLength() float64 {
+	return p.VelocityFactor * speedOfLight * p.TickDuration
+}
+
+// Stages converts a cable length in metres to an edge weight of at least one stage
+func (p Physical) Stages(metres float64) int {
+	return max(1, int(math.Round(metres/p.StageLength())))
+}
+
+// Metres is the cable length of an edge of the given weight
+func (p Physical) Metres(stages int) float64 { return float64(stages) * p.StageLength() }
+
+// Micros converts ticks to microseconds
+func (p Physical) Micros(ticks float64) float64 { return ticks * p.TickDuration * 1e6 }
+
+// Bits is the number of bits sent in the given number of ticks
+func (p Physical) Bits(ticks float64) float64 { return ticks * p.TickDuration * p.BitRate }
+
+// SetPhysical gives the simulation a physical layer. It does not change the
+// weight of existing edges.
+func (s *Simulation) SetPhysical(p Physical) { s.physical = p.withDefaults() }
+func (s *Simulation) Physical() Physical     { return s.physical }
+
+// Now is the virtual time of the simulation. It starts at the epoch and
+// advances by the tick duration of the physical layer every tick, or by a
+// microsecond without one.
+func (s *Simulation) Now() time.Time {
+	return s.epoch.Add(time.Duration(float64(s.ticks) * s.tickSeconds() * float64(time.Second)))
+}
+
+// tickSeconds is the time a tick stands for on the virtual clock
+func (s *Simulation) tickSeconds() float64 {
+	if s.physical.Enabled() {
+		return s.physical.TickDuration
+	}
+	return 1e-6
+}
+
+// SetEpoch sets the virtual time of tick zero, by default the wall clock
+// time the simulation was created at
+func (s *Simulation) SetEpoch(t time.Time) { s.epoch = t }
@@ -0,0 +1,239 @@
+package ethersim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// ICMPType is the type of an ICMP message
+type ICMPType uint8
+
+const (
+	ICMPEchoReply   ICMPType = 0
+	ICMPEchoRequest ICMPType = 8
+)
+
+const icmpEchoHeaderBytes = 8
+
+// ICMPEcho is an ICMP echo request or reply
+type ICMPEcho struct {
+	Type ICMPType
+	ID   uint16 // Identifies the ping the echo belongs to
+	Seq  uint16
+	Data []byte
+}
+
+func (e *ICMPEcho) String() string {
+	if e.Type == ICMPEchoRequest {
+		return fmt.Sprintf("ICMP echo request seq=%v", e.Seq)
+	}
+	return fmt.Sprintf("ICMP echo reply seq=%v", e.Seq)
+}
+
+// MarshalBinary encodes the echo with its checksum
+func (e *ICMPEcho) MarshalBinary() ([]byte, error) {
+	if e.Type != ICMPEchoRequest && e.Type != ICMPEchoReply {
+		return nil, fmt.Errorf("ICMP type %v is not an echo", e.Type)
+	}
+	b := make([]byte, icmpEchoHeaderBytes, icmpEchoHeaderBytes+len(e.Data))
+	b[0] = byte(e.Type)
+	binary.BigEndian.PutUint16(b[4:], e.ID)
+	binary.BigEndian.PutUint16(b[6:], e.Seq)
+	b = append(b, e.Data...)
+	binary.BigEndian.PutUint16(b[2:], ^onesSum(b))
+	return b, nil
+}
+
+func (e *ICMPEcho) UnmarshalBinary(b []byte) error {
+	if len(b) < icmpEchoHeaderBytes {
+		return fmt.Errorf("ICMP message of %v bytes", len(b))
+	}
+	if t := ICMPType(b[0]); (t != ICMPEchoRequest && t != ICMPEchoReply) || b[1] != 0 {
+		return fmt.Errorf("ICMP type %v code %v is not an echo", b[0], b[1])
+	}
+	if onesSum(b) != 0xffff {
+		return errors.New("bad ICMP checksum")
+	}
+	*e = ICMPEcho{
+		Type: ICMPType(b[0]),
+		ID:   binary.BigEndian.Uint16(b[4:]),
+		Seq:  binary.BigEndian.Uint16(b[6:]),
+		Data: append([]byte(nil), b[icmpEchoHeaderBytes:]...),
+	}
+	return nil
+}
+
+type PingReplyCb func(id int, from netip.Addr, seq int, rtt int)
+
+// Ping sends ICMP echo requests from a device to an address at a fixed
+// interval, and measures the round trip time of the replies in ticks
+type Ping struct {
+	sim    *Simulation
+	device *NetworkDevice
+	id     uint16
+
+	Dst      netip.Addr
+	Count    int // Requests to send, 0 to keep sending
+	Interval int // Ticks between requests
+	Timeout  int // Ticks after which an unanswered request counts as lost
+
+	next   int            // Tick the next request is sent at
+	sentAt map[uint16]int // Ticks the unanswered requests were sent at, by sequence number
+	seq    uint16         // Sequence number of the next request
+	sent   int
+	lost   int
+	rtts   []int
+}
+
+// PingStats summarises the round trip times of a ping in ticks
+type PingStats struct {
+	Sent     int
+	Received int
+	Lost     int // Requests that went unanswered for longer than the timeout
+	Waiting  int // Requests neither answered nor timed out yet
+	Min      int
+	Max      int
+	Avg      float64
+	Jitter   float64 // Mean difference between consecutive round trip times
+}
+
+// Loss is the percentage of requests lost
+func (s PingStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return 100 * float64(s.Lost) / float64(s.Sent)
+}
+
+func (s PingStats) String() string {
+	str := fmt.Sprintf("%v packets transmitted, %v received, %.0f%% packet loss", s.Sent, s.Received, s.Loss())
+	if s.Received > 0 {
+		str += fmt.Sprintf(", rtt min/avg/max/jitter = %v/%.1f/%v/%.1f ticks", s.Min, s.Avg, s.Max, s.Jitter)
+	}
+	return str
+}
+
+// MakePing starts pinging dst from the device every interval ticks, count
+// times or forever if count is 0. The timeout leaves room for ARP to resolve dst.
+func MakePing(d *NetworkDevice, dst netip.Addr, count int, interval int) (*Ping, error) {
+	if err := d.route(dst); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("ping interval must be positive")
+	}
+	p := &Ping{
+		sim:      d.sim,
+		device:   d,
+		id:       uint16(len(d.ip.pings) + 1),
+		Dst:      dst,
+		Count:    count,
+		Interval: interval,
+		Timeout:  max(10*interval, arpRequestLimit*d.sim.config.ARPRetryTicks),
+		next:     d.sim.ticks,
+		sentAt:   make(map[uint16]int),
+	}
+	d.ip.pings = append(d.ip.pings, p)
+	d.sim.register(p)
+	return p, nil
+}
+
+// Ping returns the ping the device started last, nil if none
+func (d *NetworkDevice) Ping() *Ping {
+	if len(d.ip.pings) == 0 {
+		return nil
+	}
+	return d.ip.pings[len(d.ip.pings)-1]
+}
+
+func (p *Ping) TickFalling() bool { return false }
+func (p *Ping) Tick() {
+	t := p.sim.ticks
+	for seq, at := range p.sentAt {
+		if t-at > p.Timeout {
+			delete(p.sentAt, seq)
+			p.lost++
+		}
+	}
+	if (p.Count > 0 && p.sent >= p.Count) || t < p.next || len(p.sentAt) > math.MaxUint16 {
+		return
+	}
+
+	// Sequence numbers wrap, so skip those of requests still waiting for a reply
+	for _, waiting := p.sentAt[p.seq]; waiting; _, waiting = p.sentAt[p.seq] {
+		p.seq++
+	}
+	seq := p.seq
+	p.seq++
+	b, _ := (&ICMPEcho{Type: ICMPEchoRequest, ID: p.id, Seq: seq, Data: []byte("ethersim")}).MarshalBinary()
+	if err := p.device.SendIP(p.Dst, IPProtocolICMP, b); err != nil {
+		// The device lost its address
+		p.lost++
+	} else {
+		p.sentAt[seq] = t
+	}
+	p.sent++
+	p.next = t + p.Interval
+}
+
+// Done reports whether every request has been sent and either answered or timed out
+func (p *Ping) Done() bool { return p.Count > 0 && p.sent >= p.Count && len(p.sentAt) == 0 }
+
+// onReply records the round trip of an answered request
+func (p *Ping) onReply(from netip.Addr, seq uint16) {
+	at, ok := p.sentAt[seq]
+	if !ok || from != p.Dst {
+		return
+	}
+	delete(p.sentAt, seq)
+	rtt := p.sim.ticks - at
+	p.rtts = append(p.rtts, rtt)
+	p.sim.onDevicePingReply(p.device.id, from, int(seq), rtt)
+}
+
+func (p *Ping) Stats() PingStats {
+	s := PingStats{Sent: p.sent, Received: len(p.rtts), Lost: p.lost, Waiting: len(p.sentAt)}
+	if len(p.rtts) == 0 {
+		return s
+	}
+	s.Min = math.MaxInt
+	sum := 0
+	for i, rtt := range p.rtts {
+		s.Min = min(s.Min, rtt)
+		s.Max = max(s.Max, rtt)
+		sum += rtt
+		if i > 0 {
+			s.Jitter += math.Abs(float64(rtt - p.rtts[i-1]))
+		}
+	}
+	s.Avg = float64(sum) / float64(len(p.rtts))
+	if len(p.rtts) > 1 {
+		s.Jitter /= float64(len(p.rtts) - 1)
+	}
+	return s
+}
+
+// handleICMP answers echo requests for the device and passes replies on to
+// the ping they belong to
+func (d *NetworkDevice) handleICMP(p *IPv4Packet) {
+	var e ICMPEcho
+	if e.UnmarshalBinary(p.Payload) != nil {
+		return
+	}
+	switch e.Type {
+	case ICMPEchoRequest:
+		if p.Dst != d.ip.addr.Addr() {
+			return
+		}
+		e.Type = ICMPEchoReply
+		b, _ := e.MarshalBinary()
+		d.SendIP(p.Src, IPProtocolICMP, b)
+	case ICMPEchoReply:
+		if e.ID > 0 && int(e.ID) <= len(d.ip.pings) {
+			d.ip.pings[e.ID-1].onReply(p.Src, e.Seq)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ethersim_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// pingPair addresses the two devices of a line and starts a ping from the
+// first to the second
+func pingPair(t *testing.T, count int, interval int) (*ethersim.Simulation, *ethersim.Ping) {
+	t.Helper()
+	s := ethersim.MakeSeededSimulation(1)
+	build(t, s, ethersim.LineTopology(2, 4))
+	if err := s.AssignIPs(netip.MustParsePrefix("10.0.0.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	d := s.Devices()
+	p, err := ethersim.MakePing(d[0], d[1].IP().Addr(), count, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, p
+}
+
+// TestPing checks that every request is accounted for while a ping runs, and
+// that the round trip times it reports are ordered
+func TestPing(t *testing.T) {
+	s, p := pingPair(t, 20, 100)
+	replies := 0
+	s.SetDevicePingReplyCb(func(id int, from netip.Addr, seq int, rtt int) { replies++ })
+	for i := 0; !p.Done(); i++ {
+		if i > 100000 {
+			t.Fatalf("ping did not finish: %v", p.Stats())
+		}
+		s.Tick()
+		if st := p.Stats(); st.Sent != st.Received+st.Lost+st.Waiting {
+			t.Fatalf("tick %v: %+v does not add up", s.Ticks(), st)
+		}
+	}
+
+	st := p.Stats()
+	if st.Sent != 20 || st.Received == 0 || st.Received != replies {
+		t.Fatalf("%+v after %v replies", st, replies)
+	}
+	if float64(st.Min) > st.Avg || st.Avg > float64(st.Max) {
+		t.Errorf("round trip times out of order: %v", st)
+	}
+}
+
+// TestPingTimeout checks that replies arriving after the timeout count as lost
+func TestPingTimeout(t *testing.T) {
+	s, p := pingPair(t, 5, 100)
+	p.Timeout = 1
+	replies := 0
+	s.SetDevicePingReplyCb(func(id int, from netip.Addr, seq int, rtt int) { replies++ })
+	late := 0
+	s.SetDeviceReceivePacketCb(func(id int, pkt *ethersim.IPv4Packet) {
+		if pkt.Protocol == ethersim.IPProtocolICMP && pkt.Src == p.Dst {
+			late++
+		}
+	})
+	for range 2000 {
+		s.Tick()
+	}
+
+	st := p.Stats()
+	if !p.Done() || late == 0 {
+		t.Fatalf("%+v with %v replies received", st, late)
+	}
+	if st.Received != 0 || replies != 0 || st.Lost != st.Sent {
+		t.Errorf("late replies were counted: %+v, %v replies", st, replies)
+	}
+}
@@ -0,0 +1,68 @@
+package ethersim
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Preset sets up a simulation after a historical network, with a tick for
+// every bit time
+type Preset struct {
+	Physical Physical
+	Config   Config
+	Format   FrameFormat
+}
+
+// Presets holds the experimental Ethernet of Metcalfe and Boggs and the
+// IEEE 802.3 10BASE5 Ethernet that followed it
+var Presets = map[string]Preset{
+	// Frames carry 64 bytes after the sync bit and the header. A slot covers
+	// the round trip of a 1 km Ether, and the retransmission interval starts
+	// at a slot and doubles with each collision.
+	"xerox": {
+		Physical: PhysicalPresets["xerox"],
+		Config: Config{
+			FrameTicks:      FormatXerox.PreambleBits() + 8*(6+64),
+			JamTicks:        32,
+			TimeoutRange:    32,
+			SlotTicks:       32,
+			MaxTimeoutRange: 256 * 32,
+			AttemptLimit:    16,
+		},
+		Format: FormatXerox,
+	},
+	// Minimum size frames, a slot time of 512 bits, a 32-bit jam and
+	// truncated binary exponential backoff over up to 1024 slots
+	"10base5": {
+		Physical: PhysicalPresets["10base5"],
+		Config: Config{
+			FrameTicks:      FormatEthernetII.PreambleBits() + 8*MinFrameBytes,
+			JamTicks:        32,
+			TimeoutRange:    2 * 512,
+			SlotTicks:       512,
+			MaxTimeoutRange: 1024 * 512,
+			AttemptLimit:    16,
+		},
+		Format: FormatEthernetII,
+	},
+}
+
+func LookupPreset(name string) (Preset, error) {
+	if p, ok := Presets[name]; ok {
+		return p, nil
+	}
+	names := make([]string, 0, len(Presets))
+	for n := range Presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Preset{}, fmt.Errorf("unknown preset %q, expected one of %v", name, names)
+}
+
+// SetPreset gives the simulation the physical layer, protocol parameters and
+// frame format of the preset
+func (s *Simulation) SetPreset(p Preset) {
+	s.SetPhysical(p.Physical)
+	s.SetConfig(p.Config)
+	s.SetFrameFormat(p.Format)
+}
@@ -0,0 +1,193 @@
+package ethersim
+
+import "slices"
+
+// Repeater joins segments into a single collision domain. It regenerates
+// what arrives on one port onto every other port after a fixed delay and,
+// under CSMA/CD, jams every segment when it sees a collision.
+type Repeater struct {
+	sim      *Simulation
+	id       int
+	ports    []link
+	delay    int
+	incoming []incMessage
+	pending  []repeated // Messages waiting out the delay, in order of arrival
+	jamTicks int
+	jamFrom  link // Port the jam being propagated arrived on, nil if the repeater saw the collision
+}
+
+type repeated struct {
+	msg  NetworkMsg
+	from link
+	at   int // Tick at which the message leaves the repeater
+}
+
+func MakeRepeater(s *Simulation, delay int) *Repeater {
+	r := &Repeater{
+		sim:      s,
+		id:       s.nextRepeaterId,
+		ports:    make([]link, 0),
+		delay:    max(0, delay),
+		incoming: make([]incMessage, 0),
+		pending:  make([]repeated, 0),
+	}
+	s.nextRepeaterId++
+	s.register(r)
+	s.repeaters = append(s.repeaters, r)
+	return r
+}
+
+func (n *NetworkNode) CreateRepeater(weight int, delay int) (*Repeater, *NetworkEdge) {
+	r := MakeRepeater(n.sim, delay)
+	return r, connect(n.sim, n, r, weight)
+}
+
+func (r *Repeater) CreateNode(weight int) (*NetworkNode, *NetworkEdge) {
+	n := MakeNetworkNode(r.sim)
+	return n, connect(r.sim, r, n, weight)
+}
+
+func (r *Repeater) CreateRepeater(weight int, delay int) (*Repeater, *NetworkEdge) {
+	rr := MakeRepeater(r.sim, delay)
+	return rr, connect(r.sim, r, rr, weight)
+}
+
+func (r *Repeater) Id() int         { return r.id }
+func (r *Repeater) Delay() int      { return r.delay }
+func (r *Repeater) IsJamming() bool { return r.jamTicks > 0 }
+func (r *Repeater) attach(l link)   { r.ports = append(r.ports, l) }
+func (r *Repeater) links() []link   { return r.ports }
+func (r *Repeater) passDelay() int  { return r.delay }
+func (r *Repeater) detach(l link) {
+	r.ports = slices.DeleteFunc(r.ports, func(p link) bool { return p == l })
+	r.pending = slices.DeleteFunc(r.pending, func(p repeated) bool { return p.from == l })
+	if r.jamFrom == l {
+		r.jamFrom = nil
+	}
+}
+
+// Network Component Interface
+// Regenerate messages after edges have ticked
+func (r *Repeater) TickFalling() bool { return true }
+func (r *Repeater) Tick() {
+	t := r.sim.ticks
+	if r.jamTicks == 0 && r.sim.protocol == ProtocolCSMACD {
+		if from, collided := r.collision(); collided {
+			r.jamTicks = r.sim.config.JamTicks
+			r.jamFrom = from
+			r.sim.onRepeaterJam(r.id)
+		}
+	}
+
+	if r.jamTicks > 0 {
+		// A frame starting on the segment the jam came from would lose its
+		// head unnoticed, so that segment is jammed too
+		for _, msg := range r.incoming {
+			if r.jamFrom != nil && r.port(msg.from) == r.jamFrom && !msg.m.IsJam() {
+				r.jamTicks = r.sim.config.JamTicks
+				r.jamFrom = nil
+			}
+		}
+		r.incoming = r.incoming[:0]
+		// What arrived before the collision leaves ahead of the jam, so that
+		// the end of a frame its sender has finished is not lost
+		if len(r.pending) > 0 {
+			r.repeat(t)
+			return
+		}
+		r.jamTicks--
+		for _, port := range r.ports {
+			if port != r.jamFrom {
+				port.OnMsg(&JamMsg{}, r)
+			}
+		}
+		return
+	}
+
+	for _, msg := range r.incoming {
+		r.pending = append(r.pending, repeated{msg: msg.m, from: r.port(msg.from), at: t + r.delay})
+	}
+	r.incoming = r.incoming[:0]
+	r.repeat(t)
+}
+
+// repeat sends the pending messages that have waited out the delay
+func (r *Repeater) repeat(t int) {
+	sent := 0
+	for _, p := range r.pending {
+		if p.at > t {
+			break
+		}
+		for _, port := range r.ports {
+			if port != p.from {
+				port.OnMsg(p.msg.Copy(), r)
+			}
+		}
+		sent++
+	}
+	r.pending = r.pending[sent:]
+}
+
+// collision reports whether the repeater sees a collision on any of its
+// segments this tick, and the port a jam arrived on if that is what it saw
+func (r *Repeater) collision() (link, bool) {
+	for _, msg := range r.incoming {
+		if msg.m.IsJam() {
+			return r.port(msg.from), true
+		}
+	}
+	if len(r.incoming) > 1 {
+		return nil, true
+	}
+
+	// A message arriving on a segment the repeater is driving
+	t := r.sim.ticks
+	for _, msg := range r.incoming {
+		from := r.port(msg.from)
+		for _, p := range r.pending {
+			if p.at <= t && p.from != from {
+				return nil, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// port returns the port a message from the given sender arrived on
+func (r *Repeater) port(from Network) link { return arrivalLink(r.ports, from) }
+
+// arrivalLink returns the link among links a message from the given sender arrived on
+func arrivalLink(links []link, from Network) link {
+	for _, l := range links {
+		if Network(l) == from {
+			return l
+		}
+	}
+	for _, l := range links {
+		if l.connects(from) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Expects to be called during the rising tick
+func (r *Repeater) OnMsg(msg NetworkMsg, from Network) {
+	r.incoming = append(r.incoming, incMessage{m: msg, from: from})
+}
+
+func (r *Repeater) incomingMsg(Network) bool {
+	return len(r.incoming) > 0 || len(r.pending) > 0
+}
+
+func (r *Repeater) isResetting(from Network) bool {
+	if r.jamTicks > 0 {
+		return true
+	}
+	for _, port := range r.ports {
+		if port != from && port.isResetting(r) {
+			return true
+		}
+	}
+	return false
+}
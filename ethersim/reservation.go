@@ -0,0 +1,223 @@
+package ethersim
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Protocol selects the medium access control used by every transceiver of a simulation
+type Protocol int
+
+const (
+	// Carrier sense multiple access with collision detection, as proposed by Metcalfe and Boggs
+	ProtocolCSMACD Protocol = iota
+	// Stations reserve the data period by sending a bit in their own contention slot
+	ProtocolBitMap
+	// Stations broadcast their address bit by bit and the highest address wins
+	ProtocolBinaryCountdown
+	// Carrier sense multiple access with collision avoidance and acknowledgements
+	ProtocolCSMACA
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolCSMACD:
+		return "CSMA/CD"
+	case ProtocolBitMap:
+		return "Bit-Map"
+	case ProtocolBinaryCountdown:
+		return "Binary Countdown"
+	case ProtocolCSMACA:
+		return "CSMA/CA"
+	}
+	return "Unknown"
+}
+
+// ParseProtocol returns the protocol with the given name
+func ParseProtocol(name string) (Protocol, error) {
+	for p := ProtocolCSMACD; p <= ProtocolCSMACA; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return ProtocolCSMACD, fmt.Errorf("unknown protocol %q", name)
+}
+
+func (p Protocol) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+func (p *Protocol) UnmarshalText(text []byte) error {
+	var err error
+	*p, err = ParseProtocol(string(text))
+	return err
+}
+
+// reserves reports whether the protocol arbitrates access in a contention
+// period of reserved slots before sending data
+func (p Protocol) reserves() bool {
+	return p == ProtocolBitMap || p == ProtocolBinaryCountdown
+}
+
+// reservationCycle is the slot clock shared by all stations. Stations only
+// learn which slots were reserved by listening to the ether.
+type reservationCycle struct {
+	start      int // Tick at which the contention period began
+	slotTicks  int // Long enough for a bit to reach every station within its slot
+	frameTicks int
+	nslots     int
+	dataStart  int // Tick at which the data period begins
+	end        int // Tick at which the next contention period begins, -1 until known
+	reserved   int // Reservation bits sent during the contention period
+}
+
+// reservation is the view a single station has of the current cycle
+type reservation struct {
+	slot      int    // Bit-map slot of the station, -1 if it has no device
+	seen      []bool // Slots in which a reservation bit was heard
+	competing bool   // Still taking part in the binary countdown
+	turn      int    // Position in the data period, -1 if not sending
+}
+
+var noReservation = reservation{slot: -1, turn: -1}
+
+func (c *reservationCycle) update(s *Simulation) {
+	if c.end >= 0 && s.ticks >= c.end {
+		c.begin(s)
+	}
+	if s.ticks == c.dataStart {
+		periods := c.reserved
+		if s.protocol == ProtocolBinaryCountdown {
+			periods = min(periods, 1)
+		}
+		c.end = c.dataStart + periods*c.dataTicks()
+	}
+}
+
+func (c *reservationCycle) begin(s *Simulation) {
+	stations := make([]*NetworkNode, 0)
+	for _, n := range s.nodes {
+		n.resv = noReservation
+		if n.deviceEdge != nil {
+			stations = append(stations, n)
+		}
+	}
+
+	c.start = s.ticks
+	c.slotTicks = s.slotTicks()
+	c.frameTicks = s.config.FrameTicks
+	c.nslots = len(stations)
+	if s.protocol == ProtocolBinaryCountdown && len(stations) > 0 {
+		c.nslots = bits.Len(uint(len(stations)))
+	}
+	c.dataStart = c.start + c.nslots*c.slotTicks
+	c.end = -1
+	c.reserved = 0
+
+	for i, n := range stations {
+		n.resv = reservation{
+			slot:      i,
+			seen:      make([]bool, c.nslots),
+			competing: len(n.outMessages) > 0,
+			turn:      -1,
+		}
+	}
+}
+
+// dataTicks is the length of a single data transmission including the time
+// for its last part to reach every station
+func (c *reservationCycle) dataTicks() int { return c.frameTicks + c.slotTicks }
+
+// addressBit returns the bit the station sends in the given countdown slot,
+// most significant bit first. Addresses start at 1 so every station sends a bit.
+func (r *reservation) addressBit(slot int, nslots int) bool {
+	return (r.slot+1)>>(nslots-1-slot)&1 == 1
+}
+
+func (n *NetworkNode) tickReservation() {
+	c := &n.sim.cycle
+	r := &n.resv
+	t := n.sim.ticks
+
+	if t < c.dataStart && r.seen != nil {
+		slot := (t - c.start) / c.slotTicks
+		signal := len(n.incMessages) > 0
+
+		var send bool
+		if n.sim.protocol == ProtocolBitMap {
+			send = slot == r.slot && len(n.outMessages) > 0
+		} else if r.competing {
+			send = r.addressBit(slot, c.nslots)
+			// A station sending a zero gives up once it hears a one
+			if !send && signal {
+				r.competing = false
+			}
+		}
+
+		if signal {
+			r.seen[slot] = true
+		}
+		if send && (t-c.start)%c.slotTicks == 0 {
+			r.seen[slot] = true
+			c.reserved++
+			for _, edge := range n.edges {
+				edge.OnMsg(&ReserveMsg{Sender: n.id}, n)
+			}
+		}
+	} else if t == c.dataStart && r.seen != nil {
+		r.turn = r.dataTurn(n.sim.protocol)
+	}
+
+	if r.turn >= 0 && t == c.dataStart+r.turn*c.dataTicks() && len(n.outMessages) > 0 {
+		n.transmitting = true
+		n.transmitRem = n.sim.config.FrameTicks
+		n.sim.onTransceiverBeginTransmit(n.id, n.outMessages[0])
+	}
+
+	if n.transmitting {
+		n.transmitRem--
+		if n.transmitRem <= 0 {
+			n.outMessages[0].SetLast()
+		}
+		for _, edge := range n.edges {
+			edge.OnMsg(n.sending(), n)
+		}
+	} else {
+		for _, edge := range n.edges {
+			for _, msg := range n.incMessages {
+				if !edge.connects(msg.from) {
+					edge.OnMsg(msg.m.Copy(), n)
+				}
+			}
+		}
+		n.deliverIncoming()
+	}
+
+	if n.transmitRem <= 0 && n.transmitting {
+		n.transmitting = false
+		r.turn = -1
+		n.sim.onTransceiverEndTransmit(n.id, n.outMessages[0])
+		n.outMessages = n.outMessages[1:]
+	}
+
+	n.incMessages = n.incMessages[:0]
+}
+
+// dataTurn returns the position of the station in the data period, or -1 if
+// it did not win a reservation
+func (r *reservation) dataTurn(p Protocol) int {
+	if p == ProtocolBinaryCountdown {
+		if r.competing {
+			return 0
+		}
+		return -1
+	}
+
+	if !r.seen[r.slot] {
+		return -1
+	}
+	turn := 0
+	for _, s := range r.seen[:r.slot] {
+		if s {
+			turn++
+		}
+	}
+	return turn
+}
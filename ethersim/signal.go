@@ -0,0 +1,296 @@
+package ethersim
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Signalling selects how messages occupy the stages of the ether
+type Signalling int
+
+const (
+	// Every stage holds a message, which a collision marks invalid
+	SignalAbstract Signalling = iota
+	// Frames are serialised and Manchester encoded, and superimposed signals add up
+	SignalManchester
+)
+
+func (sg Signalling) String() string {
+	switch sg {
+	case SignalAbstract:
+		return "abstract"
+	case SignalManchester:
+		return "manchester"
+	}
+	return "unknown"
+}
+
+// ParseSignalling returns the signalling with the given name
+func ParseSignalling(name string) (Signalling, error) {
+	for sg := SignalAbstract; sg <= SignalManchester; sg++ {
+		if sg.String() == name {
+			return sg, nil
+		}
+	}
+	return SignalAbstract, fmt.Errorf("unknown signalling %q", name)
+}
+
+func (sg Signalling) MarshalText() ([]byte, error) { return []byte(sg.String()), nil }
+func (sg *Signalling) UnmarshalText(text []byte) error {
+	var err error
+	*sg, err = ParseSignalling(string(text))
+	return err
+}
+
+// SetSignalling chooses how frames are put on the ether. Under Manchester
+// signalling, frames with a wire format are sent as bits, spread evenly over
+// the ticks of the transmission, and receivers decode them again. Other
+// messages stay abstract.
+func (s *Simulation) SetSignalling(sg Signalling) { s.signalling = sg }
+func (s *Simulation) Signalling() Signalling      { return s.signalling }
+
+// Signal carries the bits of a frame sent in one tick of its transmission.
+// Each bit is two half-bit levels: high then low for a 0 and low then high
+// for a 1. Signals that meet on the medium add up, which shows as a code
+// violation wherever a half-bit is not exactly one of low or high.
+type Signal struct {
+	NetworkMsg       // Frame the bits belong to
+	Index      int   // Tick of the transmission the bits were sent in
+	Levels     []int // Half-bit levels
+}
+
+func (sig *Signal) Valid() bool { return sig.NetworkMsg.Valid() && sig.Violations() == 0 }
+func (sig *Signal) Copy() NetworkMsg {
+	return &Signal{NetworkMsg: sig.NetworkMsg.Copy(), Index: sig.Index, Levels: append([]int(nil), sig.Levels...)}
+}
+
+// Violations counts the bits of the signal that are not valid Manchester symbols
+func (sig *Signal) Violations() int {
+	n := 0
+	for i := 0; i < len(sig.Levels); i += 2 {
+		if _, ok := symbol(sig.Levels[i:min(i+2, len(sig.Levels))]); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// symbol decodes a Manchester bit, guessing from the first half-bit when the
+// two halves do not make a valid symbol
+func symbol(levels []int) (byte, bool) {
+	if len(levels) == 2 && levels[0] == 1 && levels[1] == 0 {
+		return 0, true
+	}
+	if len(levels) == 2 && levels[0] == 0 && levels[1] == 1 {
+		return 1, true
+	}
+	if levels[0] > 0 {
+		return 0, false
+	}
+	return 1, false
+}
+
+// superimpose adds up two signals that meet on the medium
+func (sig *Signal) superimpose(o *Signal) {
+	sum := make([]int, max(len(sig.Levels), len(o.Levels)))
+	for i := range sum {
+		if i < len(sig.Levels) {
+			sum[i] += sig.Levels[i]
+		}
+		if i < len(o.Levels) {
+			sum[i] += o.Levels[i]
+		}
+	}
+	sig.Levels = sum
+	o.Levels = append([]int(nil), sum...)
+}
+
+// interfere spoils two messages that meet on the medium. Signals are
+// superimposed, and a signal meeting a message with no bits, such as a jam,
+// carries its level on top. Everything else, including signals sent in ticks
+// that fall between two bits, is marked invalid.
+func interfere(a NetworkMsg, b NetworkMsg) {
+	sa, ok1 := a.(*Signal)
+	sb, ok2 := b.(*Signal)
+	ok1 = ok1 && len(sa.Levels) > 0
+	ok2 = ok2 && len(sb.Levels) > 0
+	switch {
+	case ok1 && ok2:
+		sa.superimpose(sb)
+	case ok1:
+		sa.raise()
+		b.Invalid()
+	case ok2:
+		a.Invalid()
+		sb.raise()
+	default:
+		a.Invalid()
+		b.Invalid()
+	}
+}
+
+// raise adds a constant carrier to every half-bit of the signal
+func (sig *Signal) raise() {
+	for i := range sig.Levels {
+		sig.Levels[i]++
+	}
+}
+
+// wireBits returns the bits a frame is sent as, preamble first and every
+// byte least significant bit first, or false if it has no wire format
+func wireBits(msg NetworkMsg) ([]byte, bool) {
+	var preamble []byte
+	var b []byte
+	var err error
+	switch f := msg.(type) {
+	case *Frame:
+		// Alternating ones and zeros ending in the start frame delimiter 11
+		for i := range FormatEthernetII.PreambleBits() {
+			preamble = append(preamble, byte(1-i%2))
+		}
+		preamble[len(preamble)-1] = 1
+		b, err = f.MarshalBinary()
+	case *XeroxFrame:
+		preamble = []byte{1} // The sync bit
+		b, err = f.MarshalBinary()
+	default:
+		return nil, false
+	}
+	if err != nil {
+		return nil, false
+	}
+	bits := preamble
+	for _, c := range b {
+		for i := range 8 {
+			bits = append(bits, c>>i&1)
+		}
+	}
+	return bits, true
+}
+
+// encode returns the part of msg sent in the given tick of its transmission,
+// as a Manchester signal if the simulation signals bit by bit
+func (s *Simulation) encode(msg NetworkMsg, tick int) NetworkMsg {
+	if s.signalling != SignalManchester {
+		return msg
+	}
+	bits, ok := wireBits(msg)
+	if !ok {
+		return msg
+	}
+	frameTicks := s.config.FrameTicks
+	from, to := tick*len(bits)/frameTicks, (tick+1)*len(bits)/frameTicks
+	sig := &Signal{NetworkMsg: msg, Index: tick, Levels: make([]int, 0, 2*(to-from))}
+	for _, b := range bits[from:to] {
+		sig.Levels = append(sig.Levels, int(1-b), int(b))
+	}
+	return sig
+}
+
+// decoder reassembles a frame from the signals of its transmission
+type decoder struct {
+	bits       []byte
+	next       int  // Index of the signal expected next
+	violations int  // Bits that were not valid Manchester symbols
+	broken     bool // A signal went missing or overlapped another
+	frame      NetworkMsg
+}
+
+// spoil makes the frame being received fail, as signals from several links
+// arrived at once
+func (d *decoder) spoil() { d.broken = true }
+
+// Reasons a frame received as signals is lost
+var errCodeViolation = errors.New("Manchester code violation")
+var errSignalLost = errors.New("part of the signal went missing")
+
+// add decodes the next signal of a frame. Until the last signal, it returns
+// the signal itself. It then returns the decoded frame or, if the frame was
+// spoilt on the way, an invalid copy of the signal and the reason.
+func (d *decoder) add(sig *Signal) (NetworkMsg, error) {
+	if sig.Index == 0 {
+		*d = decoder{}
+	}
+	if sig.Index != d.next || !sig.NetworkMsg.Valid() {
+		d.broken = true
+	}
+	d.next = sig.Index + 1
+	for i := 0; i < len(sig.Levels); i += 2 {
+		b, ok := symbol(sig.Levels[i:min(i+2, len(sig.Levels))])
+		if !ok {
+			d.violations++
+		}
+		d.bits = append(d.bits, b)
+	}
+	if !sig.IsLast() {
+		return sig, nil
+	}
+
+	frame, err := d.decode(sig.NetworkMsg)
+	if d.violations > 0 {
+		err = errCodeViolation
+	} else if d.broken {
+		err = errSignalLost
+	}
+	*d = decoder{}
+	if err != nil {
+		lost := sig.Copy()
+		lost.Invalid()
+		return lost, err
+	}
+	d.frame = frame.Copy()
+	frame.SetLast()
+	return frame, nil
+}
+
+// onTransceiverReceiveError counts a frame lost by the transceiver of its
+// destination
+func (s *Simulation) onTransceiverReceiveError(id int, msg NetworkMsg, err error) {
+	if errors.Is(err, errCodeViolation) {
+		s.stats.CodeViolations++
+	} else if !errors.Is(err, errSignalLost) {
+		s.stats.ChecksumErrors++
+	}
+	if s.transceiverReceiveErrorCb != nil {
+		s.transceiverReceiveErrorCb(id, msg.Copy())
+	}
+}
+
+// SetTransceiverReceiveErrorCb is called when a frame sent as signals reaches
+// the transceiver of its destination but cannot be decoded, because of a code
+// violation, a bad checksum, or signals that went missing on the way
+func (s *Simulation) SetTransceiverReceiveErrorCb(f MsgEventCb) { s.transceiverReceiveErrorCb = f }
+
+// decode strips the preamble of the bits and unmarshals the rest into a
+// frame of the same kind as sent
+func (d *decoder) decode(sent NetworkMsg) (NetworkMsg, error) {
+	var frame interface {
+		NetworkMsg
+		UnmarshalBinary([]byte) error
+	}
+	var preamble int
+	switch sent.(type) {
+	case *Frame:
+		frame, preamble = &Frame{}, FormatEthernetII.PreambleBits()
+	case *XeroxFrame:
+		frame, preamble = &XeroxFrame{}, FormatXerox.PreambleBits()
+	default:
+		return nil, fmt.Errorf("no wire format")
+	}
+	if len(d.bits) < preamble || (len(d.bits)-preamble)%8 != 0 {
+		return nil, fmt.Errorf("%v bits do not make a frame", len(d.bits))
+	}
+	b := make([]byte, (len(d.bits)-preamble)/8)
+	for i, bit := range d.bits[preamble:] {
+		b[i/8] |= bit << (i % 8)
+	}
+	if err := frame.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	// Collision avoidance keeps its sequence control beside the wire formats,
+	// which have no field for it
+	if s, ok := sent.(Sequenced); ok {
+		frame.(Sequenced).SetSequenceControl(s.SequenceControl())
+	}
+	return frame, nil
+}
@@ -1,26 +1,97 @@
 package ethersim
 
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"time"
+)
+
 type EventCb func(id int)
 type MsgEventCb func(id int, msg NetworkMsg)
+type PortStateCb func(id int, port int, state PortState)
 
 type Simulation struct {
 	components        []NetworkComponent
 	fallingComponents []NetworkComponent
+	retired           []NetworkComponent // Components to unregister once the tick is over
+	nodes             []*NetworkNode
+	devices           []*NetworkDevice
+	edges             []*NetworkEdge
+	buses             []*BusSegment
+	repeaters         []*Repeater
+	switches          []*Switch
+	ticks             int
+	protocol          Protocol
+	rtsCts            bool
+	stp               bool
+	cycle             reservationCycle
+	maxDelay          int
+	rand              *rand.Rand
+	config            Config
+	physical          Physical
+	epoch             time.Time
+	format            FrameFormat
+	signalling        Signalling
+	stats             Stats
+	queuedAt          map[NetworkMsg]int
+	checker           *Checker
+
+	nextNodeId     int
+	nextDeviceId   int
+	nextEdgeId     int
+	nextBusId      int
+	nextRepeaterId int
+	nextSwitchId   int
 
-	onTransceiverBeginTransmit MsgEventCb
-	onTransceiverEndTransmit   MsgEventCb
-	onTransceiverJam           EventCb
-	onDeviceQueueMsg           MsgEventCb
-	onDeviceReceiveMsg         MsgEventCb
+	transceiverBeginTransmitCb MsgEventCb
+	transceiverEndTransmitCb   MsgEventCb
+	transceiverJamCb           EventCb
+	transceiverLateCollisionCb MsgEventCb
+	transceiverDropMsgCb       MsgEventCb
+	transceiverReceiveErrorCb  MsgEventCb
+	repeaterJamCb              EventCb
+	switchDropMsgCb            MsgEventCb
+	switchPortStateCb          PortStateCb
+	deviceQueueMsgCb           MsgEventCb
+	deviceDropMsgCb            MsgEventCb
+	deviceReceiveMsgCb         MsgEventCb
+	deviceSendARPCb            ARPEventCb
+	deviceReceivePacketCb      PacketEventCb
+	deviceUnreachableCb        PacketEventCb
+	devicePingReplyCb          PingReplyCb
+	deviceDeliverSegmentCb     SegmentEventCb
 }
 
+// MakeSimulation creates a simulation with a random seed
 func MakeSimulation() *Simulation {
+	return MakeSeededSimulation(rand.Uint64())
+}
+
+// MakeSeededSimulation creates a simulation whose random choices are fully
+// determined by seed. Simulations share no state and may run concurrently.
+func MakeSeededSimulation(seed uint64) *Simulation {
 	return &Simulation{
 		components:        make([]NetworkComponent, 0),
 		fallingComponents: make([]NetworkComponent, 0),
+		nodes:             make([]*NetworkNode, 0),
+		devices:           make([]*NetworkDevice, 0),
+		edges:             make([]*NetworkEdge, 0),
+		buses:             make([]*BusSegment, 0),
+		repeaters:         make([]*Repeater, 0),
+		switches:          make([]*Switch, 0),
+		protocol:          ProtocolCSMACD,
+		maxDelay:          -1,
+		rand:              rand.New(rand.NewPCG(seed, seed)),
+		config:            DefaultConfig(),
+		epoch:             time.Now(),
+		queuedAt:          make(map[NetworkMsg]int),
 	}
 }
 func (s *Simulation) Tick() {
+	if s.protocol.reserves() {
+		s.cycle.update(s)
+	}
 	// fmt.Printf("-------------tick-------------\n")
 	for _, c := range s.components {
 		c.Tick()
@@ -29,6 +100,14 @@ func (s *Simulation) Tick() {
 	for _, c := range s.fallingComponents {
 		c.Tick()
 	}
+	if len(s.retired) > 0 {
+		s.components = slices.DeleteFunc(s.components, func(c NetworkComponent) bool { return slices.Contains(s.retired, c) })
+		s.retired = s.retired[:0]
+	}
+	if s.checker != nil {
+		s.checker.check()
+	}
+	s.ticks++
 }
 func (s *Simulation) register(c NetworkComponent) {
 	if c.TickFalling() {
@@ -38,8 +117,171 @@ func (s *Simulation) register(c NetworkComponent) {
 	}
 }
 
-func (s *Simulation) SetTransceiverBeginTransmitCb(f MsgEventCb) { s.onTransceiverBeginTransmit = f }
-func (s *Simulation) SetTransceiverEndTransmitCb(f MsgEventCb)   { s.onTransceiverEndTransmit = f }
-func (s *Simulation) SetTransceiverJamCb(f EventCb)              { s.onTransceiverJam = f }
-func (s *Simulation) SetDeviceQueueMsgCb(f MsgEventCb)           { s.onDeviceQueueMsg = f }
-func (s *Simulation) SetDeviceReceiveMsgCb(f MsgEventCb)         { s.onDeviceReceiveMsg = f }
+// unregister stops ticking a component from the next tick on
+func (s *Simulation) unregister(c NetworkComponent) {
+	s.retired = append(s.retired, c)
+}
+
+// SetProtocol switches the medium access control used by every transceiver.
+// Transmissions in progress are abandoned and queued messages are kept.
+func (s *Simulation) SetProtocol(p Protocol) {
+	s.protocol = p
+	s.cycle = reservationCycle{end: s.ticks}
+	for _, n := range s.nodes {
+		n.transmitting = false
+		n.transmitRem = 0
+		n.resetTicks = 0
+		n.seenReset = false
+		n.resv = noReservation
+		n.ca = makeAvoidance()
+	}
+}
+
+// SetConfig changes the protocol parameters. Unset fields take their default values.
+func (s *Simulation) SetConfig(c Config) {
+	s.config = c.withDefaults()
+	for _, n := range s.nodes {
+		n.timeoutRange = s.config.TimeoutRange
+	}
+}
+func (s *Simulation) Config() Config { return s.config }
+
+// SetRTSCTS makes CSMA/CA stations reserve the medium with an RTS/CTS
+// handshake before sending data
+func (s *Simulation) SetRTSCTS(enabled bool) { s.rtsCts = enabled }
+func (s *Simulation) RTSCTS() bool           { return s.rtsCts }
+
+func (s *Simulation) Protocol() Protocol        { return s.protocol }
+func (s *Simulation) Ticks() int                { return s.ticks }
+func (s *Simulation) Nodes() []*NetworkNode     { return s.nodes }
+func (s *Simulation) Devices() []*NetworkDevice { return s.devices }
+func (s *Simulation) Edges() []*NetworkEdge     { return s.edges }
+func (s *Simulation) Buses() []*BusSegment      { return s.buses }
+func (s *Simulation) Repeaters() []*Repeater    { return s.repeaters }
+func (s *Simulation) Switches() []*Switch       { return s.switches }
+func (s *Simulation) Rand() *rand.Rand          { return s.rand }
+
+// Events are recorded in the statistics and passed on to the callbacks as copies
+
+func (s *Simulation) onTransceiverBeginTransmit(id int, msg NetworkMsg) {
+	s.stats.Attempts++
+	if s.transceiverBeginTransmitCb != nil {
+		s.transceiverBeginTransmitCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onTransceiverEndTransmit(id int, msg NetworkMsg) {
+	s.stats.Sent++
+	if t, ok := s.queuedAt[msg]; ok {
+		s.stats.TotalDelay += s.ticks - t
+		delete(s.queuedAt, msg)
+	}
+	if s.transceiverEndTransmitCb != nil {
+		s.transceiverEndTransmitCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onTransceiverJam(id int) {
+	s.stats.Collisions++
+	if s.transceiverJamCb != nil {
+		s.transceiverJamCb(id)
+	}
+}
+func (s *Simulation) onTransceiverLateCollision(id int, msg NetworkMsg) {
+	s.stats.LateCollisions++
+	if s.transceiverLateCollisionCb != nil {
+		s.transceiverLateCollisionCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onTransceiverDropMsg(id int, msg NetworkMsg) {
+	s.stats.Dropped++
+	delete(s.queuedAt, msg)
+	if s.transceiverDropMsgCb != nil {
+		s.transceiverDropMsgCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onRepeaterJam(id int) {
+	if s.repeaterJamCb != nil {
+		s.repeaterJamCb(id)
+	}
+}
+func (s *Simulation) onSwitchDropMsg(id int, msg NetworkMsg) {
+	s.stats.Dropped++
+	if s.switchDropMsgCb != nil {
+		s.switchDropMsgCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onSwitchPortState(id int, port int, state PortState) {
+	if s.switchPortStateCb != nil {
+		s.switchPortStateCb(id, port, state)
+	}
+}
+func (s *Simulation) onDeviceQueueMsg(id int, msg NetworkMsg) {
+	s.stats.Queued++
+	s.queuedAt[msg] = s.ticks
+	if s.deviceQueueMsgCb != nil {
+		s.deviceQueueMsgCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onDeviceDropMsg(id int, msg NetworkMsg) {
+	s.stats.Dropped++
+	if s.deviceDropMsgCb != nil {
+		s.deviceDropMsgCb(id, msg.Copy())
+	}
+}
+func (s *Simulation) onDeviceReceiveMsg(id int, msg NetworkMsg) {
+	s.stats.Delivered++
+	if s.deviceReceiveMsgCb != nil {
+		s.deviceReceiveMsgCb(id, msg.Copy())
+	}
+}
+
+func (s *Simulation) onDeviceSendARP(id int, p *ARPPacket) {
+	if p.Op == ARPRequest {
+		s.stats.ARPRequests++
+	} else {
+		s.stats.ARPReplies++
+	}
+	if s.deviceSendARPCb != nil {
+		s.deviceSendARPCb(id, p)
+	}
+}
+func (s *Simulation) onDeviceReceivePacket(id int, p *IPv4Packet) {
+	if s.deviceReceivePacketCb != nil {
+		s.deviceReceivePacketCb(id, p)
+	}
+}
+func (s *Simulation) onDeviceUnreachable(id int, p *IPv4Packet) {
+	s.stats.Unreachable++
+	if s.deviceUnreachableCb != nil {
+		s.deviceUnreachableCb(id, p)
+	}
+}
+func (s *Simulation) onDevicePingReply(id int, from netip.Addr, seq int, rtt int) {
+	if s.devicePingReplyCb != nil {
+		s.devicePingReplyCb(id, from, seq, rtt)
+	}
+}
+func (s *Simulation) onDeviceDeliverSegment(id int, from netip.Addr, seg *Segment) {
+	if s.deviceDeliverSegmentCb != nil {
+		s.deviceDeliverSegmentCb(id, from, seg)
+	}
+}
+
+func (s *Simulation) SetTransceiverBeginTransmitCb(f MsgEventCb) { s.transceiverBeginTransmitCb = f }
+func (s *Simulation) SetTransceiverEndTransmitCb(f MsgEventCb)   { s.transceiverEndTransmitCb = f }
+func (s *Simulation) SetTransceiverJamCb(f EventCb)              { s.transceiverJamCb = f }
+func (s *Simulation) SetTransceiverLateCollisionCb(f MsgEventCb) { s.transceiverLateCollisionCb = f }
+func (s *Simulation) SetTransceiverDropMsgCb(f MsgEventCb)       { s.transceiverDropMsgCb = f }
+func (s *Simulation) SetRepeaterJamCb(f EventCb)                 { s.repeaterJamCb = f }
+func (s *Simulation) SetSwitchDropMsgCb(f MsgEventCb)            { s.switchDropMsgCb = f }
+func (s *Simulation) SetSwitchPortStateCb(f PortStateCb)         { s.switchPortStateCb = f }
+func (s *Simulation) SetDeviceQueueMsgCb(f MsgEventCb)           { s.deviceQueueMsgCb = f }
+func (s *Simulation) SetDeviceDropMsgCb(f MsgEventCb)            { s.deviceDropMsgCb = f }
+func (s *Simulation) SetDeviceReceiveMsgCb(f MsgEventCb)         { s.deviceReceiveMsgCb = f }
+func (s *Simulation) SetDeviceSendARPCb(f ARPEventCb)            { s.deviceSendARPCb = f }
+func (s *Simulation) SetDeviceReceivePacketCb(f PacketEventCb)   { s.deviceReceivePacketCb = f }
+func (s *Simulation) SetDeviceUnreachableCb(f PacketEventCb)     { s.deviceUnreachableCb = f }
+func (s *Simulation) SetDevicePingReplyCb(f PingReplyCb)         { s.devicePingReplyCb = f }
+
+// SetDeviceDeliverSegmentCb is called with every data segment a device
+// receives over a connection, in order and once each
+func (s *Simulation) SetDeviceDeliverSegmentCb(f SegmentEventCb) { s.deviceDeliverSegmentCb = f }
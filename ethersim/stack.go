@@ -0,0 +1,250 @@
+package ethersim
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Requests sent for an address before the packets waiting on it are dropped
+var arpRequestLimit int = 3
+
+type PacketEventCb func(id int, p *IPv4Packet)
+type ARPEventCb func(id int, p *ARPPacket)
+
+// stack is the optional IPv4 network layer of a device
+type stack struct {
+	addr      netip.Prefix // Address and subnet of the device, invalid if it has none
+	cache     map[netip.Addr]arpEntry
+	waiting   []*arpWait // Addresses being resolved, oldest first
+	nextID    uint16
+	pings     []*Ping       // Pings started by the device, by identifier less one
+	conns     []*Connection // Connections opened by the device, by identifier less one
+	receivers map[connKey]*receiver
+	ports     map[uint16]*PacketConn // UDP sockets, by the port they listen on
+}
+
+type arpEntry struct {
+	mac     MAC
+	expires int // Tick the entry is forgotten at
+}
+
+// arpWait holds the packets for an address until ARP resolves it
+type arpWait struct {
+	ip       netip.Addr
+	packets  []*IPv4Packet
+	requests int
+	retryAt  int
+}
+
+// LimitedBroadcast is the IPv4 address every device of the subnet receives
+var LimitedBroadcast = netip.AddrFrom4([4]byte{255, 255, 255, 255})
+
+// ErrNoAddress is returned for IPv4 traffic from a device with no address
+var ErrNoAddress = errors.New("device has no IPv4 address")
+
+// SetIP gives the device an IPv4 address and subnet, such as 10.0.0.1/24, and
+// clears its ARP cache. The zero prefix takes its address away.
+func (d *NetworkDevice) SetIP(addr netip.Prefix) error {
+	if addr.IsValid() && (!addr.Addr().Is4() || addr.Bits() >= 31 || addr.Addr() == addr.Masked().Addr() || addr.Addr() == subnetBroadcast(addr)) {
+		return fmt.Errorf("invalid device address %v", addr)
+	}
+	d.ip.addr = addr
+	d.ip.cache = make(map[netip.Addr]arpEntry)
+	d.ip.waiting = nil
+	d.ip.receivers = make(map[connKey]*receiver)
+	return nil
+}
+
+// IP returns the address and subnet of the device, invalid if it has none
+func (d *NetworkDevice) IP() netip.Prefix { return d.ip.addr }
+
+// ARPCache returns the addresses the device has resolved and not yet forgotten
+func (d *NetworkDevice) ARPCache() map[netip.Addr]MAC {
+	cache := make(map[netip.Addr]MAC)
+	for ip, e := range d.ip.cache {
+		if e.expires > d.sim.ticks {
+			cache[ip] = e.mac
+		}
+	}
+	return cache
+}
+
+// subnetBroadcast returns the directed broadcast address of a subnet
+func subnetBroadcast(p netip.Prefix) netip.Addr {
+	a := p.Masked().Addr().As4()
+	for i := p.Bits(); i < 32; i++ {
+		a[i/8] |= 0x80 >> (i % 8)
+	}
+	return netip.AddrFrom4(a)
+}
+
+// SendIP sends payload in an IPv4 packet to dst, which must be on the
+// device's subnet as there are no routers. The packet waits for ARP to
+// resolve the address of dst if it is not cached.
+func (d *NetworkDevice) SendIP(dst netip.Addr, proto IPProtocol, payload []byte) error {
+	if err := d.route(dst); err != nil {
+		return err
+	}
+	p := &IPv4Packet{ID: d.ip.nextID, TTL: ipv4DefaultTTL, Protocol: proto, Src: d.ip.addr.Addr(), Dst: dst, Payload: payload}
+	if _, err := p.MarshalBinary(); err != nil {
+		return err
+	}
+	d.ip.nextID++
+
+	if dst == LimitedBroadcast || dst == subnetBroadcast(d.ip.addr) {
+		d.sendPacket(Broadcast, p)
+		return nil
+	}
+	if e, ok := d.ip.cache[dst]; ok && e.expires > d.sim.ticks {
+		d.sendPacket(e.mac, p)
+		return nil
+	}
+	for _, w := range d.ip.waiting {
+		if w.ip == dst {
+			w.packets = append(w.packets, p)
+			return nil
+		}
+	}
+	w := &arpWait{ip: dst, packets: []*IPv4Packet{p}}
+	d.ip.waiting = append(d.ip.waiting, w)
+	d.request(w)
+	return nil
+}
+
+// route checks that the device can send to dst
+func (d *NetworkDevice) route(dst netip.Addr) error {
+	if !d.ip.addr.IsValid() {
+		return ErrNoAddress
+	}
+	if dst != LimitedBroadcast && !d.ip.addr.Contains(dst) {
+		return fmt.Errorf("no route to %v from %v", dst, d.ip.addr)
+	}
+	return nil
+}
+
+func (d *NetworkDevice) sendPacket(dst MAC, p *IPv4Packet) {
+	b, _ := p.MarshalBinary()
+	d.QueueMessage(d.MakeFrame(dst, EtherTypeIPv4, b))
+}
+
+func (d *NetworkDevice) sendARP(dst MAC, p *ARPPacket) {
+	b, _ := p.MarshalBinary()
+	d.QueueMessage(d.MakeFrame(dst, EtherTypeARP, b))
+	d.sim.onDeviceSendARP(d.id, p)
+}
+
+// request broadcasts an ARP request for the address w waits on
+func (d *NetworkDevice) request(w *arpWait) {
+	w.requests++
+	w.retryAt = d.sim.ticks + d.sim.config.ARPRetryTicks
+	d.sendARP(Broadcast, &ARPPacket{Op: ARPRequest, SenderMAC: d.MAC(), SenderIP: d.ip.addr.Addr(), TargetIP: w.ip})
+}
+
+// tickARP repeats requests that went unanswered, and drops the packets
+// waiting on an address once the request limit has been reached
+func (d *NetworkDevice) tickARP() {
+	d.ip.waiting = slices.DeleteFunc(d.ip.waiting, func(w *arpWait) bool {
+		if d.sim.ticks < w.retryAt {
+			return false
+		}
+		if w.requests < arpRequestLimit {
+			d.request(w)
+			return false
+		}
+		for _, p := range w.packets {
+			d.sim.onDeviceUnreachable(d.id, p)
+		}
+		return true
+	})
+}
+
+// handleFrame passes a frame the device received to its network layer
+func (d *NetworkDevice) handleFrame(msg NetworkMsg) {
+	f, ok := msg.(*Frame)
+	if !ok || !d.ip.addr.IsValid() {
+		return
+	}
+	switch f.EtherType {
+	case EtherTypeARP:
+		var p ARPPacket
+		if p.UnmarshalBinary(f.Payload) == nil {
+			d.handleARP(&p)
+		}
+	case EtherTypeIPv4:
+		var p IPv4Packet
+		if p.UnmarshalBinary(f.Payload) != nil {
+			return
+		}
+		if p.Dst != d.ip.addr.Addr() && p.Dst != LimitedBroadcast && p.Dst != subnetBroadcast(d.ip.addr) {
+			return
+		}
+		d.sim.onDeviceReceivePacket(d.id, &p)
+		switch p.Protocol {
+		case IPProtocolICMP:
+			d.handleICMP(&p)
+		case IPProtocolUDP:
+			d.handleUDP(&p)
+		case IPProtocolTransport:
+			if p.Dst == d.ip.addr.Addr() {
+				d.handleSegment(&p)
+			}
+		}
+	}
+}
+
+// handleARP follows RFC 826: the sender's address is updated if cached, and
+// learnt if the packet is for this device, which answers requests
+func (d *NetworkDevice) handleARP(p *ARPPacket) {
+	me := d.ip.addr.Addr()
+	if _, cached := d.ip.cache[p.SenderIP]; cached || p.TargetIP == me {
+		d.ip.cache[p.SenderIP] = arpEntry{mac: p.SenderMAC, expires: d.sim.ticks + d.sim.config.ARPTimeoutTicks}
+		d.resolved(p.SenderIP, p.SenderMAC)
+	}
+	if p.Op == ARPRequest && p.TargetIP == me {
+		d.sendARP(p.SenderMAC, &ARPPacket{Op: ARPReply, SenderMAC: d.MAC(), SenderIP: me, TargetMAC: p.SenderMAC, TargetIP: p.SenderIP})
+	}
+}
+
+// resolved sends the packets waiting on an address that ARP has resolved
+func (d *NetworkDevice) resolved(ip netip.Addr, mac MAC) {
+	i := slices.IndexFunc(d.ip.waiting, func(w *arpWait) bool { return w.ip == ip })
+	if i < 0 {
+		return
+	}
+	for _, p := range d.ip.waiting[i].packets {
+		d.sendPacket(mac, p)
+	}
+	d.ip.waiting = slices.Delete(d.ip.waiting, i, i+1)
+}
+
+// AssignIPs gives the devices without an address consecutive host addresses
+// of the subnet, in the order they were created
+func (s *Simulation) AssignIPs(subnet netip.Prefix) error {
+	if !subnet.Addr().Is4() {
+		return fmt.Errorf("invalid IPv4 subnet %v", subnet)
+	}
+	subnet = subnet.Masked()
+	used := make(map[netip.Addr]bool)
+	for _, d := range s.devices {
+		used[d.ip.addr.Addr()] = true
+	}
+	next := subnet.Addr().Next()
+	for _, d := range s.devices {
+		if d.ip.addr.IsValid() {
+			continue
+		}
+		for used[next] {
+			next = next.Next()
+		}
+		if !subnet.Contains(next) || next == subnetBroadcast(subnet) {
+			return fmt.Errorf("subnet %v has too few addresses for %v devices", subnet, len(s.devices))
+		}
+		if err := d.SetIP(netip.PrefixFrom(next, subnet.Bits())); err != nil {
+			return err
+		}
+		next = next.Next()
+	}
+	return nil
+}
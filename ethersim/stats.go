@@ -0,0 +1,81 @@
+package ethersim
+
+// Stats counts what happened during a simulation
+type Stats struct {
+	Ticks      int
+	FrameTicks int // Ticks taken to send a single frame
+	Queued     int // Messages queued by devices
+	Attempts   int // Transmissions begun by transceivers
+	Sent       int // Transmissions that ended without a collision
+	Delivered  int // Messages received by their destination device
+	Dropped    int // Messages given up on by transceivers or refused by full device queues
+	Collisions int // Collisions detected by transceivers
+	TotalDelay int // Ticks from queueing to the end of transmission, summed over sent messages
+
+	LateCollisions int // Collisions detected more than a slot time after the transmission began
+	Reflections    int // Messages echoed back off unterminated ends
+	CodeViolations int // Frames their destination lost to Manchester code violations
+	ChecksumErrors int // Frames their destination decoded cleanly but with a bad checksum
+
+	ARPRequests int // ARP requests broadcast by devices
+	ARPReplies  int // ARP replies sent by devices
+	Unreachable int // IPv4 packets dropped as ARP could not resolve their destination
+
+	Physical Physical // Physical layer to report in microseconds and bits, if enabled
+}
+
+func (s *Simulation) Stats() Stats {
+	stats := s.stats
+	stats.Ticks = s.ticks
+	stats.FrameTicks = s.config.FrameTicks
+	stats.Physical = s.physical
+	return stats
+}
+
+// Throughput is the number of delivered messages per tick
+func (s Stats) Throughput() float64 {
+	if s.Ticks == 0 {
+		return 0
+	}
+	return float64(s.Delivered) / float64(s.Ticks)
+}
+
+// OfferedLoad is the number of frames queued per frame time
+func (s Stats) OfferedLoad() float64 {
+	if s.Ticks == 0 {
+		return 0
+	}
+	return float64(s.Queued*s.FrameTicks) / float64(s.Ticks)
+}
+
+// Efficiency is the fraction of ticks the ether spent carrying frames that
+// were sent without a collision
+func (s Stats) Efficiency() float64 {
+	if s.Ticks == 0 {
+		return 0
+	}
+	return min(1, float64(s.Sent*s.FrameTicks)/float64(s.Ticks))
+}
+
+// MeanDelay is the mean number of ticks from queueing a message to the end
+// of its transmission
+func (s Stats) MeanDelay() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.TotalDelay) / float64(s.Sent)
+}
+
+// MeanDelayMicros is the mean delay in microseconds
+func (s Stats) MeanDelayMicros() float64 { return s.Physical.Micros(s.MeanDelay()) }
+
+// FrameBits is the number of bits in a frame
+func (s Stats) FrameBits() float64 { return s.Physical.Bits(float64(s.FrameTicks)) }
+
+// BitThroughput is the number of bits delivered per second
+func (s Stats) BitThroughput() float64 {
+	if s.Physical.TickDuration == 0 {
+		return 0
+	}
+	return s.Throughput() * s.FrameBits() / s.Physical.TickDuration
+}
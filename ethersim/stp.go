@@ -0,0 +1,405 @@
+package ethersim
+
+import "fmt"
+
+// Path cost IEEE 802.1D gives a port on a 10 Mb/s link
+var stpPortCost int = 100
+
+// Priority of a bridge until it is set otherwise, the middle of the range
+var defaultBridgePriority int = 32768
+var maxBridgePriority int = 65535
+
+// Destination of frames addressed to every bridge, standing in for the
+// 01-80-C2-00-00-00 multicast address
+var bridgeGroupAddress int = -2
+
+// BridgeID identifies a switch to the spanning tree protocol. The bridge with
+// the lowest priority becomes the root, ties are broken by the switch id.
+type BridgeID struct {
+	Priority int
+	Id       int
+}
+
+func (b BridgeID) less(o BridgeID) bool {
+	if b.Priority != o.Priority {
+		return b.Priority < o.Priority
+	}
+	return b.Id < o.Id
+}
+
+func (b BridgeID) String() string { return fmt.Sprintf("%v.S%v", b.Priority, b.Id) }
+
+type BPDUKind int
+
+const (
+	BPDUConfig BPDUKind = iota // Carries the root a bridge believes in and its cost to reach it
+	BPDUTCN                    // Tells the root that the active topology changed
+)
+
+func (k BPDUKind) String() string {
+	switch k {
+	case BPDUConfig:
+		return "Config BPDU"
+	case BPDUTCN:
+		return "TCN BPDU"
+	}
+	return "?"
+}
+
+// BPDU is a bridge protocol data unit exchanged by switches running the
+// spanning tree protocol. It is never forwarded, only sent from bridge to bridge.
+type BPDU struct {
+	V      bool
+	Kind   BPDUKind
+	Root   BridgeID
+	Cost   int // Path cost from the sender to the root
+	Bridge BridgeID
+	Port   int  // Port the sender sent the message on
+	Age    int  // Ticks since the root sent the information
+	TC     bool // The root asks bridges to forget what they learnt
+	Last   bool
+}
+
+func (m *BPDU) Valid() bool   { return m.V }
+func (m *BPDU) Invalid()      { m.V = false }
+func (m *BPDU) From() int     { return m.Bridge.Id }
+func (m *BPDU) IsJam() bool   { return false }
+func (m *BPDU) IsLast() bool  { return m.Last }
+func (m *BPDU) Value() string { return m.Kind.String() }
+func (m *BPDU) Dest() int     { return bridgeGroupAddress }
+func (m *BPDU) SetLast()      { m.Last = true }
+func (m *BPDU) Copy() NetworkMsg {
+	c := *m
+	return &c
+}
+
+// priority vector of a BPDU, lower is better
+func (m *BPDU) better(o *BPDU) bool {
+	if m.Root != o.Root {
+		return m.Root.less(o.Root)
+	}
+	if m.Cost != o.Cost {
+		return m.Cost < o.Cost
+	}
+	if m.Bridge != o.Bridge {
+		return m.Bridge.less(o.Bridge)
+	}
+	return m.Port < o.Port
+}
+
+// PortRole is the part a switch port plays in the spanning tree
+type PortRole int
+
+const (
+	PortDesignated PortRole = iota // Sends towards the leaves of the tree
+	PortRoot                       // Leads towards the root bridge
+	PortAlternate                  // Would close a loop, so it stays blocked
+)
+
+func (r PortRole) String() string {
+	switch r {
+	case PortDesignated:
+		return "Designated"
+	case PortRoot:
+		return "Root"
+	case PortAlternate:
+		return "Alternate"
+	}
+	return "?"
+}
+
+// PortState is whether a switch port passes frames
+type PortState int
+
+const (
+	PortForwarding PortState = iota // Learns addresses and forwards frames
+	PortBlocking                    // Only listens to BPDUs
+	PortListening                   // Takes part in the protocol but passes no frames
+	PortLearning                    // Learns addresses but passes no frames yet
+)
+
+func (st PortState) String() string {
+	switch st {
+	case PortForwarding:
+		return "Forwarding"
+	case PortBlocking:
+		return "Blocking"
+	case PortListening:
+		return "Listening"
+	case PortLearning:
+		return "Learning"
+	}
+	return "?"
+}
+
+// SetSpanningTree makes every switch run the IEEE 802.1D spanning tree
+// protocol, so that bridged topologies may contain loops: ports that would
+// close a loop between switches are blocked. Enabling it starts the protocol
+// afresh with every port blocked, disabling it lets every port forward.
+func (s *Simulation) SetSpanningTree(enabled bool) {
+	s.stp = enabled
+	for _, sw := range s.switches {
+		sw.resetSpanningTree()
+	}
+}
+func (s *Simulation) SpanningTree() bool { return s.stp }
+
+// SetBridgePriority changes the priority the switch is elected root with
+func (sw *Switch) SetBridgePriority(p int) error {
+	if p < 0 || p > maxBridgePriority {
+		return fmt.Errorf("invalid bridge priority %v", p)
+	}
+	sw.priority = p
+	if sw.sim.stp {
+		sw.updateRoles()
+	}
+	return nil
+}
+
+func (sw *Switch) BridgeID() BridgeID { return BridgeID{Priority: sw.priority, Id: sw.id} }
+
+// Root returns the bridge the switch believes to be the root of the spanning tree
+func (sw *Switch) Root() BridgeID { return sw.root }
+func (sw *Switch) RootCost() int  { return sw.cost }
+
+// PortRole returns the role of port i in the spanning tree
+func (sw *Switch) PortRole(i int) PortRole { return sw.ports[i].role }
+
+// PortState returns whether port i passes frames
+func (sw *Switch) PortState(i int) PortState { return sw.ports[i].state }
+
+// resetSpanningTree makes the switch claim to be the root, blocking every port
+// while the protocol runs, or forwarding on every port while it does not
+func (sw *Switch) resetSpanningTree() {
+	sw.root = sw.BridgeID()
+	sw.cost = 0
+	sw.rootPort = nil
+	sw.helloAt = sw.sim.ticks
+	sw.tcUntil = sw.sim.ticks
+	sw.tcn = false
+	for _, p := range sw.ports {
+		p.info = nil
+		p.role = PortDesignated
+		if sw.sim.stp {
+			sw.setState(p, PortBlocking)
+		} else {
+			sw.setState(p, PortForwarding)
+		}
+	}
+	if sw.sim.stp {
+		sw.updateRoles()
+	}
+}
+
+// tickSpanningTree ages what the switch heard, moves ports towards
+// forwarding and sends the hellos of the root bridge
+func (sw *Switch) tickSpanningTree() {
+	t := sw.sim.ticks
+	sw.updateRoles()
+	for _, p := range sw.ports {
+		if t-p.stateAt < sw.sim.config.ForwardDelayTicks {
+			continue
+		}
+		switch p.state {
+		case PortListening:
+			sw.setState(p, PortLearning)
+		case PortLearning:
+			sw.setState(p, PortForwarding)
+			sw.topologyChange()
+		}
+	}
+
+	if sw.rootPort == nil && t >= sw.helloAt {
+		sw.helloAt = t + sw.sim.config.HelloTicks
+		sw.sendConfig()
+	}
+	if sw.tcn && sw.rootPort != nil {
+		sw.tcn = false
+		sw.sendBPDU(sw.rootPort, &BPDU{V: true, Kind: BPDUTCN, Bridge: sw.BridgeID(), Port: sw.portID(sw.rootPort)})
+	}
+}
+
+// onBPDU handles a BPDU that arrived in full on p
+func (sw *Switch) onBPDU(p *switchPort, b *BPDU) {
+	if !sw.sim.stp {
+		return
+	}
+	if b.Kind == BPDUTCN {
+		if p.role == PortDesignated {
+			sw.topologyChange()
+		}
+		return
+	}
+
+	// Two ports of the switch share a segment. The one sending the worse BPDU
+	// learns of the other at once, as it may never get to hear it on a busy segment.
+	if b.Bridge == sw.BridgeID() {
+		for _, q := range sw.ports {
+			if q != p && q.num == b.Port && sw.config(p).better(b) {
+				q.info, q.infoAt = sw.config(p), sw.sim.ticks
+			}
+		}
+	}
+
+	// Information from the designated bridge of the segment replaces what it
+	// sent before, even if it is worse
+	if p.info == nil || !p.info.better(b) || (p.info.Bridge == b.Bridge && p.info.Port == b.Port) {
+		p.info = b
+		p.infoAt = sw.sim.ticks
+	}
+
+	root, cost := sw.root, sw.cost
+	sw.updateRoles()
+	switch {
+	case p == sw.rootPort:
+		// Relay the hello of the root
+		if b.TC {
+			sw.flush()
+		}
+		sw.tc = b.TC
+		sw.sendConfig()
+	case root != sw.root || cost != sw.cost:
+		sw.sendConfig()
+	case p.role == PortDesignated && b.Bridge != sw.BridgeID():
+		// Correct a bridge that does not know a better root yet
+		sw.sendBPDU(p, sw.config(p))
+	}
+}
+
+// updateRoles forgets information that is too old, elects the root port and
+// gives every port its role
+func (sw *Switch) updateRoles() {
+	t := sw.sim.ticks
+	self := sw.BridgeID()
+	best := &BPDU{Root: self, Bridge: self}
+	var rootPort *switchPort
+	for _, p := range sw.ports {
+		if p.info != nil && p.info.Age+t-p.infoAt >= sw.sim.config.MaxAgeTicks {
+			p.info = nil
+		}
+		if p.info == nil || p.info.Bridge == self {
+			continue
+		}
+		c := &BPDU{Root: p.info.Root, Cost: p.info.Cost + stpPortCost, Bridge: p.info.Bridge, Port: p.info.Port}
+		if c.better(best) || (rootPort != nil && *c == *best && sw.portID(p) < sw.portID(rootPort)) {
+			best, rootPort = c, p
+		}
+	}
+
+	if rootPort == nil && sw.rootPort != nil {
+		// Start sending hellos as the new root
+		sw.helloAt = t
+	}
+	sw.root, sw.cost, sw.rootPort = best.Root, best.Cost, rootPort
+	for _, p := range sw.ports {
+		switch {
+		case p == rootPort:
+			p.role = PortRoot
+		case p.info == nil || sw.config(p).better(p.info):
+			p.role = PortDesignated
+		default:
+			p.role = PortAlternate
+		}
+
+		if p.role == PortAlternate && p.state != PortBlocking {
+			if p.state == PortForwarding {
+				sw.topologyChange()
+			}
+			sw.setState(p, PortBlocking)
+		} else if p.role != PortAlternate && p.state == PortBlocking {
+			sw.setState(p, PortListening)
+		}
+	}
+}
+
+// config is the configuration BPDU the switch sends on p
+func (sw *Switch) config(p *switchPort) *BPDU {
+	b := &BPDU{
+		V:      true,
+		Kind:   BPDUConfig,
+		Root:   sw.root,
+		Cost:   sw.cost,
+		Bridge: sw.BridgeID(),
+		Port:   sw.portID(p),
+		TC:     sw.sim.ticks < sw.tcUntil,
+	}
+	if r := sw.rootPort; r != nil {
+		b.Age = r.info.Age + sw.sim.ticks - r.infoAt + 1
+		b.TC = sw.tc
+	}
+	return b
+}
+
+// sendConfig sends a configuration BPDU on every designated port
+func (sw *Switch) sendConfig() {
+	for _, p := range sw.ports {
+		if p.role == PortDesignated {
+			sw.sendBPDU(p, sw.config(p))
+		}
+	}
+}
+
+// sendBPDU queues b ahead of every frame that is not being sent yet,
+// replacing a BPDU of the same kind that is still waiting
+func (sw *Switch) sendBPDU(p *switchPort, b *BPDU) {
+	i := 0
+	if p.txRem > 0 {
+		i = 1
+	}
+	for j := i; j < len(p.queue); j++ {
+		if q, ok := p.queue[j].(*BPDU); ok && q.Kind == b.Kind {
+			p.queue[j] = b
+			return
+		}
+	}
+	p.queue = append(p.queue[:i], append([]NetworkMsg{b}, p.queue[i:]...)...)
+}
+
+// topologyChange makes the switch forget what it learnt, since stations may
+// now be reached over other ports, and tells the root so that every other
+// bridge does the same
+func (sw *Switch) topologyChange() {
+	sw.flush()
+	if sw.rootPort == nil {
+		sw.tcUntil = sw.sim.ticks + sw.sim.config.MaxAgeTicks + sw.sim.config.ForwardDelayTicks
+	} else {
+		sw.tcn = true
+	}
+}
+
+// flush forgets every learnt address
+func (sw *Switch) flush() { clear(sw.table) }
+
+// setState moves p to a new state, discarding the frames waiting on it if it
+// no longer forwards and the BPDUs too if it is blocked
+func (sw *Switch) setState(p *switchPort, st PortState) {
+	if p.state == st {
+		return
+	}
+	p.state = st
+	p.stateAt = sw.sim.ticks
+	if st != PortForwarding {
+		sw.discard(p, st == PortBlocking)
+	}
+	sw.sim.onSwitchPortState(sw.id, sw.Port(p.link), st)
+}
+
+// discard drops the frames waiting on p that are not being sent yet
+func (sw *Switch) discard(p *switchPort, bpdus bool) {
+	i := 0
+	if p.txRem > 0 {
+		i = 1
+	}
+	kept := p.queue[:i]
+	for _, msg := range p.queue[i:] {
+		if _, ok := msg.(*BPDU); !ok {
+			sw.sim.onSwitchDropMsg(sw.id, msg)
+		} else if !bpdus {
+			kept = append(kept, msg)
+		}
+	}
+	p.queue = kept
+}
+
+// portID returns the number of p in BPDUs
+func (sw *Switch) portID(p *switchPort) int { return p.num }
@@ -0,0 +1,452 @@
+package ethersim
+
+import "slices"
+
+// Maximum number of frames waiting on each output port of a switch
+var switchQueueLimit int = 64
+
+// Switch stores each frame it receives in full, learns which port every
+// device sits behind and forwards the frame out of that port only, or out of
+// every other port while the destination is unknown. Each port queues frames
+// and sends them one at a time, so every port is its own collision domain.
+type Switch struct {
+	sim      *Simulation
+	id       int
+	ports    []*switchPort
+	table    map[station]*switchPort // Port each device was last heard behind
+	incoming []incMessage
+
+	// Spanning tree
+	priority int
+	root     BridgeID
+	cost     int
+	rootPort *switchPort // nil while the switch is the root
+	helloAt  int         // Tick the root sends its next hello
+	tcUntil  int         // Tick until which the root flags a topology change
+	tc       bool        // The root flags a topology change
+	tcn      bool        // A topology change notification is waiting to be sent to the root
+	nextPort int
+}
+
+// station is a device as seen by a switch, which learns addresses per VLAN
+type station struct {
+	vlan int
+	id   int
+}
+
+type switchPort struct {
+	link    link
+	vlan    PortVLAN
+	queue   []NetworkMsg
+	rx      NetworkMsg // First part of the frame being received, nil if none
+	broken  bool       // The frame being received collided or was corrupted
+	decoder decoder    // Bits of the frame being received under Manchester signalling
+	txRem   int        // Ticks left of the frame at the head of the queue
+
+	backoff  int // Idle ticks to wait before sending on a shared segment
+	attempts int
+	jamTicks int
+
+	reply    NetworkMsg // CTS or ACK to send once the SIFS has passed
+	replyAt  int
+	replyRem int
+	received sequences // Sequence numbers of the data frames answered for stations beyond the port
+
+	num     int // Port number in BPDUs, which stays the same as other ports come and go
+	role    PortRole
+	state   PortState
+	stateAt int   // Tick the port entered its state
+	info    *BPDU // Best configuration heard on the port, nil if none
+	infoAt  int   // Tick the information was heard
+}
+
+func MakeSwitch(s *Simulation) *Switch {
+	sw := &Switch{
+		sim:      s,
+		id:       s.nextSwitchId,
+		ports:    make([]*switchPort, 0),
+		table:    make(map[station]*switchPort),
+		incoming: make([]incMessage, 0),
+		priority: defaultBridgePriority,
+	}
+	sw.root = sw.BridgeID()
+	s.nextSwitchId++
+	s.register(sw)
+	s.switches = append(s.switches, sw)
+	return sw
+}
+
+// CreateSwitch creates a switch joined to the transceiver by a full-duplex edge
+func (n *NetworkNode) CreateSwitch(weight int) (*Switch, *NetworkEdge) {
+	sw := MakeSwitch(n.sim)
+	e := connect(n.sim, n, sw, weight)
+	e.SetDuplex(true)
+	return sw, e
+}
+
+// CreateNode creates a transceiver joined to the switch by a full-duplex edge
+func (sw *Switch) CreateNode(weight int) (*NetworkNode, *NetworkEdge) {
+	n := MakeNetworkNode(sw.sim)
+	e := connect(sw.sim, sw, n, weight)
+	e.SetDuplex(true)
+	return n, e
+}
+
+// CreateSwitch creates a switch joined to this one by a full-duplex edge
+func (sw *Switch) CreateSwitch(weight int) (*Switch, *NetworkEdge) {
+	ss := MakeSwitch(sw.sim)
+	e := connect(sw.sim, sw, ss, weight)
+	e.SetDuplex(true)
+	return ss, e
+}
+
+func (sw *Switch) Id() int        { return sw.id }
+func (sw *Switch) passDelay() int { return sw.sim.config.FrameTicks }
+func (sw *Switch) attach(l link) {
+	p := &switchPort{link: l, vlan: PortVLAN{Mode: PortTrunk, VLAN: defaultVLAN}, received: make(sequences), num: sw.nextPort}
+	sw.nextPort++
+	sw.ports = append(sw.ports, p)
+	if sw.sim.stp {
+		sw.setState(p, PortBlocking)
+		sw.updateRoles()
+	}
+}
+func (sw *Switch) detach(l link) {
+	i := sw.Port(l)
+	if i < 0 {
+		return
+	}
+	p := sw.ports[i]
+	for _, msg := range p.queue {
+		if _, ok := msg.(*BPDU); !ok {
+			sw.sim.onSwitchDropMsg(sw.id, msg)
+		}
+	}
+	for s, q := range sw.table {
+		if q == p {
+			delete(sw.table, s)
+		}
+	}
+	sw.ports = append(sw.ports[:i], sw.ports[i+1:]...)
+	if sw.sim.stp {
+		if p.state == PortForwarding {
+			sw.topologyChange()
+		}
+		if p == sw.rootPort {
+			sw.rootPort = nil
+		}
+		root, cost := sw.root, sw.cost
+		sw.updateRoles()
+		if root != sw.root || cost != sw.cost {
+			sw.sendConfig()
+		}
+	}
+}
+func (sw *Switch) links() []link {
+	links := make([]link, len(sw.ports))
+	for i, p := range sw.ports {
+		links[i] = p.link
+	}
+	return links
+}
+
+// Queued returns the number of frames waiting on each port, in the order the ports were attached
+func (sw *Switch) Queued() []int {
+	queued := make([]int, len(sw.ports))
+	for i, p := range sw.ports {
+		queued[i] = len(p.queue)
+	}
+	return queued
+}
+
+// Learnt returns the number of devices whose port the switch knows
+func (sw *Switch) Learnt() int { return len(sw.table) }
+
+// Network Component Interface
+// Receive and send after edges have ticked
+func (sw *Switch) TickFalling() bool { return true }
+func (sw *Switch) Tick() {
+	if sw.sim.stp {
+		sw.tickSpanningTree()
+	}
+
+	arrived := make(map[*switchPort]int)
+	for _, msg := range sw.incoming {
+		if p := sw.port(msg.from); p != nil {
+			arrived[p]++
+		}
+	}
+
+	for _, msg := range sw.incoming {
+		p := sw.port(msg.from)
+		if p == nil {
+			continue
+		}
+		if msg.m.IsJam() {
+			p.rx = nil
+			continue
+		}
+		m := msg.m
+		if sig, ok := m.(*Signal); ok {
+			m, _ = p.decoder.add(sig)
+		}
+		if p.rx == nil || p.rx.From() != m.From() || p.rx.Value() != m.Value() {
+			p.rx = m.Copy()
+			p.broken = false
+		}
+		if arrived[p] > 1 || !m.Valid() {
+			p.broken = true
+		}
+		if m.IsLast() {
+			if _, ok := msg.m.(*Signal); ok && !p.broken {
+				p.rx = p.decoder.frame
+			}
+			if !p.broken {
+				sw.receive(p, p.rx)
+			}
+			p.rx = nil
+		}
+	}
+	sw.incoming = sw.incoming[:0]
+
+	for _, p := range sw.ports {
+		// Frames are sent without a break, so one that stops early was abandoned
+		if arrived[p] == 0 {
+			p.rx = nil
+		}
+		sw.send(p, arrived[p] > 0)
+	}
+}
+
+// receive handles a frame that arrived in full on p, dropping it if the port
+// does not carry its VLAN. Ports that do not forward only listen to BPDUs and,
+// while learning, to the addresses of senders. Under CSMA/CA the switch
+// answers RTS and data frames on shared segments for the stations beyond it,
+// as an access point does, and keeps control frames on the segment they were
+// sent on.
+func (sw *Switch) receive(p *switchPort, msg NetworkMsg) {
+	if b, ok := msg.(*BPDU); ok {
+		sw.onBPDU(p, b)
+		return
+	}
+	if p.state != PortForwarding && p.state != PortLearning {
+		return
+	}
+	vlan, ok := p.vlan.ingress(msg)
+	if !ok {
+		sw.sim.onSwitchDropMsg(sw.id, msg)
+		return
+	}
+
+	ctrl, isCtrl := msg.(*ControlMsg)
+	if sw.sim.protocol == ProtocolCSMACA && !fullDuplex(p.link) && !broadcast(msg) && sw.table[station{vlan, msg.Dest()}] != p {
+		if !isCtrl {
+			sw.respond(p, &ControlMsg{V: true, Kind: ControlACK, Sender: msg.Dest(), To: msg.From(), Seq: seqOf(msg)})
+			if p.received.duplicate(msg) {
+				return
+			}
+		} else if ctrl.Kind == ControlRTS {
+			sw.respond(p, &ControlMsg{
+				V:        true,
+				Kind:     ControlCTS,
+				Sender:   msg.Dest(),
+				To:       msg.From(),
+				Duration: ctrl.Duration - numSIFSTicks - numControlTicks - sw.sim.slotTicks(),
+			})
+		}
+	}
+	if !isCtrl && p.state == PortLearning {
+		sw.table[station{vlan, msg.From()}] = p
+	} else if !isCtrl {
+		sw.forward(p, msg, vlan)
+	}
+}
+
+func (sw *Switch) respond(p *switchPort, reply NetworkMsg) {
+	p.reply = reply
+	p.replyAt = sw.sim.ticks + numSIFSTicks
+	p.replyRem = numControlTicks
+}
+
+// forward queues a frame of a VLAN received on in for the port its
+// destination was learnt on, or for every other port of the VLAN if the
+// destination is unknown
+func (sw *Switch) forward(in *switchPort, msg NetworkMsg, vlan int) {
+	sw.table[station{vlan, msg.From()}] = in
+	if out, ok := sw.table[station{vlan, msg.Dest()}]; ok {
+		if out != in && out.state == PortForwarding {
+			sw.enqueue(out, out.vlan.egress(msg, vlan))
+		}
+		return
+	}
+	for _, p := range sw.ports {
+		if p != in && p.state == PortForwarding && p.vlan.carries(vlan) {
+			sw.enqueue(p, p.vlan.egress(msg.Copy(), vlan))
+		}
+	}
+}
+
+// enqueue queues msg behind every frame of the same or higher priority,
+// leaving a frame that is already being sent at the head, so that higher
+// priority frames overtake lower priority ones
+func (sw *Switch) enqueue(p *switchPort, msg NetworkMsg) {
+	if len(p.queue) >= switchQueueLimit {
+		sw.sim.onSwitchDropMsg(sw.id, msg)
+		return
+	}
+	i := len(p.queue)
+	for i > 0 && (i > 1 || p.txRem == 0) && VLANOf(p.queue[i-1]).Priority < VLANOf(msg).Priority {
+		i--
+	}
+	p.queue = slices.Insert(p.queue, i, msg)
+}
+
+// send puts the next part of the frame at the head of the queue on the port.
+// A port on a shared medium defers to traffic it is receiving before starting
+// a frame and, under CSMA/CD, jams, backs off and retries when the frame
+// collides, as a transceiver would.
+func (sw *Switch) send(p *switchPort, busy bool) {
+	shared := !fullDuplex(p.link)
+	if shared && sw.sim.protocol == ProtocolCSMACD {
+		if busy && p.txRem > 0 {
+			p.txRem = 0
+			p.jamTicks = sw.sim.config.JamTicks
+			p.attempts++
+			if p.attempts >= sw.sim.config.AttemptLimit {
+				p.attempts = 0
+				sw.sim.onSwitchDropMsg(sw.id, p.queue[0])
+				p.queue = p.queue[1:]
+			}
+		}
+		if p.jamTicks > 0 {
+			p.jamTicks--
+			p.link.OnMsg(&JamMsg{}, sw)
+			return
+		}
+		// A backoff already running is only frozen, so that a busy segment
+		// cannot keep the port from ever sending
+		if busy && p.backoff == 0 {
+			p.backoff = sw.sim.rand.IntN(min(sw.sim.config.TimeoutRange<<p.attempts, sw.sim.config.MaxTimeoutRange)) + 1
+		}
+	}
+	// Responses follow the frame they answer without deferring
+	if p.reply != nil && p.txRem == 0 && sw.sim.ticks >= p.replyAt {
+		p.replyRem--
+		msg := p.reply.Copy()
+		if p.replyRem <= 0 {
+			msg.SetLast()
+			p.reply = nil
+		}
+		p.link.OnMsg(msg, sw)
+		return
+	}
+
+	if busy && shared && p.txRem == 0 {
+		return
+	}
+	if p.backoff > 0 {
+		p.backoff--
+		return
+	}
+
+	if p.txRem == 0 {
+		if len(p.queue) == 0 {
+			return
+		}
+		p.txRem = sw.sim.config.FrameTicks
+	}
+
+	p.txRem--
+	msg := p.queue[0].Copy()
+	if p.txRem == 0 {
+		msg.SetLast()
+		p.queue = p.queue[1:]
+		p.attempts = 0
+	}
+	p.link.OnMsg(sw.sim.encode(msg, sw.sim.config.FrameTicks-1-p.txRem), sw)
+}
+
+// port returns the port a message from the given sender arrived on
+func (sw *Switch) port(from Network) *switchPort {
+	l := arrivalLink(sw.links(), from)
+	for _, p := range sw.ports {
+		if p.link == l {
+			return p
+		}
+	}
+	return nil
+}
+
+// Expects to be called during the rising tick
+func (sw *Switch) OnMsg(msg NetworkMsg, from Network) {
+	sw.incoming = append(sw.incoming, incMessage{m: msg, from: from})
+}
+
+func (sw *Switch) incomingMsg(dest Network) bool {
+	for _, p := range sw.ports {
+		if p.txRem > 0 && Network(p.link) == dest {
+			return true
+		}
+	}
+	return false
+}
+
+// Jams end at a switch
+func (sw *Switch) isResetting(Network) bool { return false }
+
+// fullDuplex reports whether both ends of l agree to use it full duplex. It
+// must be a duplex edge and repeaters only ever share a medium. A transceiver
+// repeats what it hears onto every other link, so it supports full duplex
+// only as a station alone on a point-to-point edge.
+func fullDuplex(l link) bool {
+	e, ok := l.(*NetworkEdge)
+	if !ok || !e.duplex {
+		return false
+	}
+	for _, end := range e.ends() {
+		switch end := end.(type) {
+		case *Repeater:
+			return false
+		case *NetworkNode:
+			if len(end.edges) != 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fullDuplex reports whether the transceiver is a station on a full-duplex
+// edge, so that nothing it sends can collide
+func (n *NetworkNode) fullDuplex() bool {
+	return len(n.edges) == 1 && fullDuplex(n.edges[0])
+}
+
+// tickFullDuplex sends frames back to back without carrier sense or
+// collision detection, whatever the protocol, and receives at the same time
+func (n *NetworkNode) tickFullDuplex() {
+	if !n.transmitting && len(n.outMessages) > 0 {
+		n.transmitting = true
+		n.transmitRem = n.sim.config.FrameTicks
+		n.txStart = n.sim.ticks
+		n.sim.onTransceiverBeginTransmit(n.id, n.outMessages[0])
+	}
+
+	if n.transmitting {
+		n.transmitRem--
+		msg := n.outMessages[0].Copy()
+		if n.transmitRem <= 0 {
+			msg.SetLast()
+		}
+		n.edges[0].OnMsg(n.sim.encode(msg, n.sim.config.FrameTicks-1-n.transmitRem), n)
+	}
+
+	if n.transmitting && n.transmitRem <= 0 {
+		n.transmitting = false
+		n.sim.onTransceiverEndTransmit(n.id, n.outMessages[0])
+		n.outMessages = n.outMessages[1:]
+	}
+
+	n.deliverIncoming()
+	n.incMessages = n.incMessages[:0]
+}
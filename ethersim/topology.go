@@ -0,0 +1,396 @@
+package ethersim
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// MaxPropagationDelay returns the largest number of ticks a message needs to
+// travel between any two transceivers of the simulation, or between a
+// transceiver and a switch port on its segment
+func (s *Simulation) MaxPropagationDelay() int {
+	if s.maxDelay >= 0 {
+		return s.maxDelay
+	}
+	s.maxDelay = 0
+	for _, n := range s.nodes {
+		for _, d := range propagationDelays(n) {
+			s.maxDelay = max(s.maxDelay, d)
+		}
+	}
+	for _, sw := range s.switches {
+		for _, d := range propagationDelays(sw) {
+			s.maxDelay = max(s.maxDelay, d)
+		}
+	}
+	return s.maxDelay
+}
+
+// RoundTripDelay is the worst-case number of ticks between a transceiver
+// starting to transmit and hearing a collision, the slot time the topology needs
+func (s *Simulation) RoundTripDelay() int { return 2 * s.MaxPropagationDelay() }
+
+// slotTicks is the length of a slot in which a message reaches every transceiver
+func (s *Simulation) slotTicks() int { return s.MaxPropagationDelay() + 1 }
+
+// topologyChanged invalidates everything derived from the topology
+func (s *Simulation) topologyChanged() { s.maxDelay = -1 }
+
+// propagationDelays returns the shortest delay in ticks from a transceiver or
+// switch to every transceiver and switch it can reach, including the time spent
+// passing repeaters. Switches end a collision domain, so delays are not measured through them.
+func propagationDelays(n junction) map[junction]int {
+	dist := map[junction]int{n: 0}
+	done := make(map[junction]bool)
+	for {
+		var cur junction
+		for j, d := range dist {
+			if !done[j] && (cur == nil || d < dist[cur]) {
+				cur = j
+			}
+		}
+		if cur == nil {
+			break
+		}
+		done[cur] = true
+		if _, ok := cur.(*Switch); ok && cur != n {
+			continue
+		}
+
+		through := dist[cur]
+		if cur != n {
+			through += cur.passDelay()
+		}
+		for _, l := range cur.links() {
+			l.neighbours(cur, func(next junction, w int) {
+				if d, seen := dist[next]; !seen || through+w < d {
+					dist[next] = through + w
+				}
+			})
+		}
+	}
+
+	delays := make(map[junction]int)
+	for j, d := range dist {
+		switch j.(type) {
+		case *NetworkNode, *Switch:
+			delays[j] = d
+		}
+	}
+	return delays
+}
+
+// Topology describes a tree of transceivers, repeaters, switches and their devices,
+// with bus segments tapped by new or existing transceivers and extra links
+// that close loops
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Buses []TopologyBus  `json:"buses,omitempty"`
+	Links []TopologyLink `json:"links,omitempty"`
+}
+
+// TopologyNode is a transceiver, repeater or switch hanging off an earlier node of the topology
+type TopologyNode struct {
+	Parent int `json:"parent"` // Index of the parent node, -1 for the root
+	Weight int `json:"weight"` // Weight of the edge to the parent
+	Device int `json:"device"` // Weight of the edge to the device, 0 for no device
+
+	DeviceDuplex bool `json:"device_duplex,omitempty"` // The edge to the device carries a separate channel in each direction
+
+	Length float64 `json:"length,omitempty"` // Cable length to the parent in metres, overrides Weight
+
+	Unterminated bool `json:"unterminated,omitempty"` // Reflect messages arriving at this end of the edge to the parent
+	Duplex       bool `json:"duplex,omitempty"`       // The edge to the parent carries a separate channel in each direction
+
+	Repeater bool `json:"repeater,omitempty"` // A repeater instead of a transceiver
+	Delay    int  `json:"delay,omitempty"`    // Ticks the repeater takes to regenerate a message
+
+	Switch         bool  `json:"switch,omitempty"`          // A switch instead of a transceiver
+	Access         int   `json:"access,omitempty"`          // Make the port of the parent switch facing this node an access port of this VLAN
+	BridgePriority int   `json:"bridge_priority,omitempty"` // Spanning tree priority of the switch, the default if 0
+	Trunk          []int `json:"trunk,omitempty"`           // VLANs the trunk port of the parent switch facing this node carries, all if empty
+
+	VLAN     int    `json:"vlan,omitempty"`     // VLAN the device tags its frames with, 0 for untagged
+	Priority int    `json:"priority,omitempty"` // Priority of the frames the device tags
+	IP       string `json:"ip,omitempty"`       // IPv4 address and prefix length of the device, such as 10.0.0.1/24
+}
+
+// TopologyBus is a bus segment with transceivers tapped along it
+type TopologyBus struct {
+	Weight int           `json:"weight"`           // Length of the cable in stages
+	Length float64       `json:"length,omitempty"` // Length of the cable in metres, overrides Weight
+	Taps   []TopologyTap `json:"taps"`
+
+	Unterminated []int `json:"unterminated,omitempty"` // Ends without a terminator, 0 for the start and 1 for the far end
+}
+
+// TopologyTap is a new transceiver tapped onto a bus, or an existing one if Node is set
+type TopologyTap struct {
+	Position int  `json:"position"`       // Stages from the start of the cable
+	Device   int  `json:"device"`         // Weight of the edge to the device, 0 for no device
+	Node     *int `json:"node,omitempty"` // Index of an earlier transceiver or repeater to tap
+
+	DeviceDuplex bool `json:"device_duplex,omitempty"` // The edge to the device carries a separate channel in each direction
+
+	VLAN     int    `json:"vlan,omitempty"`     // VLAN the device tags its frames with, 0 for untagged
+	Priority int    `json:"priority,omitempty"` // Priority of the frames the device tags
+	IP       string `json:"ip,omitempty"`       // IPv4 address and prefix length of the device, such as 10.0.0.1/24
+}
+
+// TopologyLink is an edge between two nodes that are already joined some
+// other way, such as a redundant link between switches
+type TopologyLink struct {
+	From   int     `json:"from"` // Index of a node or, counting on after the nodes, of a tapped transceiver
+	To     int     `json:"to"`
+	Weight int     `json:"weight"`
+	Length float64 `json:"length,omitempty"` // Cable length in metres, overrides Weight
+	Duplex bool    `json:"duplex,omitempty"`
+}
+
+// Build creates the topology in s and returns its transceivers in order,
+// followed by the new transceivers tapped onto each bus. Repeaters and
+// switches are skipped, but count towards the indices taps refer to.
+func (t *Topology) Build(s *Simulation) ([]*NetworkNode, error) {
+	nodes := make([]*NetworkNode, 0, len(t.Nodes))
+	junctions := make([]junction, 0, len(t.Nodes))
+	for i, tn := range t.Nodes {
+		var j junction
+		if tn.Repeater && tn.Switch {
+			return nil, fmt.Errorf("node %v: cannot be both a repeater and a switch", i)
+		} else if tn.Repeater {
+			j = MakeRepeater(s, tn.Delay)
+		} else if tn.Switch {
+			sw := MakeSwitch(s)
+			if tn.BridgePriority > 0 {
+				if err := sw.SetBridgePriority(tn.BridgePriority); err != nil {
+					return nil, fmt.Errorf("node %v: %w", i, err)
+				}
+			}
+			j = sw
+		} else {
+			j = MakeNetworkNode(s)
+		}
+
+		if tn.Parent >= i {
+			return nil, fmt.Errorf("node %v: parent %v must be an earlier node", i, tn.Parent)
+		} else if tn.Parent >= 0 {
+			if tn.Length > 0 {
+				if !s.physical.Enabled() {
+					return nil, fmt.Errorf("node %v: cable length needs a physical layer", i)
+				}
+				tn.Weight = s.physical.Stages(tn.Length)
+			}
+			if tn.Weight <= 0 {
+				return nil, fmt.Errorf("node %v: edge weight must be positive", i)
+			}
+			e := connect(s, junctions[tn.Parent], j, tn.Weight)
+			e.SetTerminated(j, !tn.Unterminated)
+			e.SetDuplex(tn.Duplex)
+			if err := configurePort(junctions[tn.Parent], e, tn); err != nil {
+				return nil, fmt.Errorf("node %v: %w", i, err)
+			}
+		}
+
+		if n, ok := j.(*NetworkNode); ok {
+			if tn.Device > 0 {
+				d, e := n.CreateDevice(tn.Device)
+				e.SetDuplex(tn.DeviceDuplex)
+				if err := configureDevice(d, tn.VLAN, tn.Priority, tn.IP); err != nil {
+					return nil, fmt.Errorf("node %v: %w", i, err)
+				}
+			}
+			nodes = append(nodes, n)
+		} else if tn.Device > 0 {
+			return nil, fmt.Errorf("node %v: repeaters and switches have no device", i)
+		}
+		junctions = append(junctions, j)
+	}
+
+	for i, tb := range t.Buses {
+		if tb.Length > 0 {
+			if !s.physical.Enabled() {
+				return nil, fmt.Errorf("bus %v: cable length needs a physical layer", i)
+			}
+			tb.Weight = s.physical.Stages(tb.Length)
+		}
+		if tb.Weight <= 0 {
+			return nil, fmt.Errorf("bus %v: length must be positive", i)
+		}
+		b := MakeBusSegment(s, tb.Weight)
+		for _, end := range tb.Unterminated {
+			if end != 0 && end != 1 {
+				return nil, fmt.Errorf("bus %v: unknown end %v", i, end)
+			}
+			b.SetTerminated(end, false)
+		}
+		for j, tap := range tb.Taps {
+			if tap.Node != nil {
+				if *tap.Node < 0 || *tap.Node >= len(junctions) {
+					return nil, fmt.Errorf("bus %v tap %v: unknown node %v", i, j, *tap.Node)
+				}
+				if !b.Tap(junctions[*tap.Node], tap.Position) {
+					return nil, fmt.Errorf("bus %v tap %v: position %v is taken or off the cable", i, j, tap.Position)
+				}
+				continue
+			}
+			n := b.CreateTap(tap.Position)
+			if n == nil {
+				return nil, fmt.Errorf("bus %v tap %v: position %v is taken or off the cable", i, j, tap.Position)
+			}
+			if tap.Device > 0 {
+				d, e := n.CreateDevice(tap.Device)
+				e.SetDuplex(tap.DeviceDuplex)
+				if err := configureDevice(d, tap.VLAN, tap.Priority, tap.IP); err != nil {
+					return nil, fmt.Errorf("bus %v tap %v: %w", i, j, err)
+				}
+			}
+			nodes = append(nodes, n)
+			junctions = append(junctions, n)
+		}
+	}
+
+	for i, tl := range t.Links {
+		if tl.From < 0 || tl.From >= len(junctions) || tl.To < 0 || tl.To >= len(junctions) {
+			return nil, fmt.Errorf("link %v: unknown node", i)
+		}
+		if tl.Length > 0 {
+			if !s.physical.Enabled() {
+				return nil, fmt.Errorf("link %v: cable length needs a physical layer", i)
+			}
+			tl.Weight = s.physical.Stages(tl.Length)
+		}
+		e, err := s.Connect(junctions[tl.From], junctions[tl.To], tl.Weight)
+		if err != nil {
+			return nil, fmt.Errorf("link %v: %w", i, err)
+		}
+		e.SetDuplex(tl.Duplex)
+	}
+	return nodes, nil
+}
+
+// configureDevice sets the VLAN tag and IPv4 address of a device
+func configureDevice(d *NetworkDevice, vlan int, priority int, ip string) error {
+	if err := d.SetVLAN(VLANTag{ID: vlan, Priority: priority}); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	addr, err := netip.ParsePrefix(ip)
+	if err != nil {
+		return err
+	}
+	return d.SetIP(addr)
+}
+
+// configurePort sets up the VLANs of the port of parent facing the node on edge e
+func configurePort(parent junction, e *NetworkEdge, tn TopologyNode) error {
+	if tn.Access == 0 && len(tn.Trunk) == 0 {
+		return nil
+	}
+	sw, ok := parent.(*Switch)
+	if !ok {
+		return fmt.Errorf("only switch ports carry VLANs")
+	}
+	if tn.Access > 0 {
+		return sw.SetAccess(sw.Port(e), tn.Access)
+	}
+	return sw.SetTrunk(sw.Port(e), defaultVLAN, tn.Trunk...)
+}
+
+// LineTopology is a line of n transceivers, each with a device
+func LineTopology(n int, weight int) Topology {
+	t := Topology{Nodes: make([]TopologyNode, n)}
+	for i := range n {
+		t.Nodes[i] = TopologyNode{Parent: i - 1, Weight: weight, Device: weight}
+	}
+	return t
+}
+
+// StarTopology is a hub transceiver surrounded by n transceivers with devices
+func StarTopology(n int, weight int) Topology {
+	t := Topology{Nodes: make([]TopologyNode, n+1)}
+	t.Nodes[0] = TopologyNode{Parent: -1}
+	for i := range n {
+		t.Nodes[i+1] = TopologyNode{Parent: 0, Weight: weight, Device: weight}
+	}
+	return t
+}
+
+// BusTopology is a single cable with n transceivers tapped at equal spacing,
+// each with a device
+func BusTopology(n int, spacing int) Topology {
+	b := TopologyBus{Weight: max(1, (n-1)*spacing), Taps: make([]TopologyTap, n)}
+	for i := range n {
+		b.Taps[i] = TopologyTap{Position: i * spacing, Device: spacing}
+	}
+	return Topology{Buses: []TopologyBus{b}}
+}
+
+// RepeatedBusTopology is a chain of bus segments joined by repeaters, each
+// segment with the given number of stations tapped at equal spacing
+func RepeatedBusTopology(segments int, stations int, spacing int, delay int) Topology {
+	t := Topology{}
+	length := max(1, (stations+1)*spacing)
+	for i := range segments {
+		b := TopologyBus{Weight: length}
+		if i > 0 {
+			prev := len(t.Nodes) - 1
+			b.Taps = append(b.Taps, TopologyTap{Position: 0, Node: &prev})
+		}
+		for j := range stations {
+			b.Taps = append(b.Taps, TopologyTap{Position: (j + 1) * spacing, Device: spacing})
+		}
+		if i < segments-1 {
+			t.Nodes = append(t.Nodes, TopologyNode{Parent: -1, Repeater: true, Delay: delay})
+			next := len(t.Nodes) - 1
+			b.Taps = append(b.Taps, TopologyTap{Position: length, Node: &next})
+		}
+		t.Buses = append(t.Buses, b)
+	}
+	return t
+}
+
+// SwitchedTopology is a switch surrounded by n transceivers with devices,
+// each on its own full-duplex edge and with a full-duplex cable to its device
+func SwitchedTopology(n int, weight int) Topology {
+	t := StarTopology(n, weight)
+	t.Nodes[0].Switch = true
+	for i := range n {
+		t.Nodes[i+1].Duplex = true
+		t.Nodes[i+1].DeviceDuplex = true
+	}
+	return t
+}
+
+// VLANTopology is a switch surrounded by n transceivers with devices on
+// full-duplex edges, with the switch ports alternating between access ports
+// of the given number of VLANs
+func VLANTopology(n int, weight int, vlans int) Topology {
+	t := SwitchedTopology(n, weight)
+	for i := range n {
+		t.Nodes[i+1].Access = 1 + i%max(1, vlans)
+	}
+	return t
+}
+
+// RedundantTopology is a ring of n switches, each with a transceiver and its
+// device on a full-duplex edge. The ring closes a loop, so it needs the
+// spanning tree protocol.
+func RedundantTopology(n int, weight int) Topology {
+	t := Topology{}
+	for i := range n {
+		parent := -1
+		if i > 0 {
+			parent = 2 * (i - 1)
+		}
+		t.Nodes = append(t.Nodes,
+			TopologyNode{Parent: parent, Weight: weight, Duplex: true, Switch: true},
+			TopologyNode{Parent: 2 * i, Weight: weight, Device: weight, Duplex: true, DeviceDuplex: true},
+		)
+	}
+	if n > 2 {
+		t.Links = append(t.Links, TopologyLink{From: 2 * (n - 1), To: 0, Weight: weight, Duplex: true})
+	}
+	return t
+}
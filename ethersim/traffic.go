@@ -0,0 +1,41 @@
+package ethersim
+
+import "fmt"
+
+// Traffic makes every device of a simulation queue messages at random. Each
+// tick, every device queues a message to a random peer with probability Rate,
+// in the frame format of the simulation or as an IPv4 packet if both have addresses.
+type Traffic struct {
+	sim  *Simulation
+	Rate float64
+}
+
+func MakeTraffic(s *Simulation, rate float64) *Traffic {
+	t := &Traffic{sim: s, Rate: rate}
+	s.register(t)
+	return t
+}
+
+func (t *Traffic) TickFalling() bool { return false }
+func (t *Traffic) Tick() {
+	devices := t.sim.devices
+	if len(devices) < 2 {
+		return
+	}
+	for _, d := range devices {
+		if t.sim.rand.Float64() >= t.Rate {
+			continue
+		}
+		dest := devices[t.sim.rand.IntN(len(devices)-1)]
+		if dest == d {
+			dest = devices[len(devices)-1]
+		}
+		payload := fmt.Sprintf("%v", t.sim.rand.IntN(10))
+		// Devices with addresses on a shared subnet talk over IPv4, resolving
+		// each other with ARP
+		if d.ip.addr.IsValid() && d.SendIP(dest.ip.addr.Addr(), IPProtocolExperimental, []byte(payload)) == nil {
+			continue
+		}
+		d.QueueMessage(t.sim.format.message(d.Id(), dest.Id(), payload))
+	}
+}
@@ -0,0 +1,414 @@
+package ethersim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// ARQ selects how a connection recovers the segments the network loses
+type ARQ int
+
+const (
+	// The sender resends every unacknowledged segment when the oldest times
+	// out, and the receiver discards segments that arrive out of order
+	ARQGoBackN ARQ = iota
+	// The sender resends only the segments that time out, and the receiver
+	// buffers segments that arrive out of order and acknowledges each one
+	ARQSelectiveRepeat
+)
+
+func (a ARQ) String() string {
+	switch a {
+	case ARQGoBackN:
+		return "go-back-n"
+	case ARQSelectiveRepeat:
+		return "selective-repeat"
+	}
+	return "unknown"
+}
+
+// ParseARQ returns the ARQ scheme with the given name
+func ParseARQ(name string) (ARQ, error) {
+	for a := ARQGoBackN; a <= ARQSelectiveRepeat; a++ {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return ARQGoBackN, fmt.Errorf("unknown ARQ scheme %q", name)
+}
+
+func (a ARQ) MarshalText() ([]byte, error) { return []byte(a.String()), nil }
+func (a *ARQ) UnmarshalText(text []byte) error {
+	var err error
+	*a, err = ParseARQ(string(text))
+	return err
+}
+
+const (
+	segmentHeaderBytes     = 14
+	segmentFlagAck         = 1 << 0
+	segmentFlagSelective   = 1 << 1
+	maxSegmentReceiveAhead = 1024 // Segments a receiver buffers ahead of the next one it expects, at most
+	maxTimeoutBackoff      = 64   // Multiple of its initial value the retransmission timeout backs off to, at most
+)
+
+// MaxSegmentBytes is the most data a segment carries in one frame
+const MaxSegmentBytes = MaxPayloadBytes - ipv4HeaderBytes - segmentHeaderBytes
+
+// Segment is a transport data segment or acknowledgement, carried in an IPv4 packet
+type Segment struct {
+	Conn      uint16 // Identifies the connection at its sender
+	Ack       bool   // Acknowledges data, and carries none
+	Selective bool   // Sent under selective repeat, where an acknowledgement also covers Seq on its own
+	Seq       uint32 // Number of the data segment, or of the one acknowledged
+	Next      uint32 // Number of the next segment expected in order, in acknowledgements
+	Data      []byte
+}
+
+func (s *Segment) String() string {
+	switch {
+	case !s.Ack:
+		return fmt.Sprintf("Segment seq=%v", s.Seq)
+	case s.Selective:
+		return fmt.Sprintf("Segment ack=%v sack=%v", s.Next, s.Seq)
+	}
+	return fmt.Sprintf("Segment ack=%v", s.Next)
+}
+
+// MarshalBinary encodes the segment with a checksum over its header and data
+func (s *Segment) MarshalBinary() ([]byte, error) {
+	if s.Ack && len(s.Data) > 0 {
+		return nil, errors.New("acknowledgement carrying data")
+	}
+	b := make([]byte, segmentHeaderBytes, segmentHeaderBytes+len(s.Data))
+	binary.BigEndian.PutUint16(b[0:], s.Conn)
+	if s.Ack {
+		b[2] |= segmentFlagAck
+	}
+	if s.Selective {
+		b[2] |= segmentFlagSelective
+	}
+	binary.BigEndian.PutUint32(b[4:], s.Seq)
+	binary.BigEndian.PutUint32(b[8:], s.Next)
+	b = append(b, s.Data...)
+	binary.BigEndian.PutUint16(b[12:], ^onesSum(b))
+	return b, nil
+}
+
+func (s *Segment) UnmarshalBinary(b []byte) error {
+	if len(b) < segmentHeaderBytes {
+		return fmt.Errorf("segment of %v bytes", len(b))
+	}
+	if b[2]&^(segmentFlagAck|segmentFlagSelective) != 0 || b[3] != 0 {
+		return fmt.Errorf("segment flags %#x", b[2:4])
+	}
+	if b[2]&segmentFlagAck != 0 && len(b) > segmentHeaderBytes {
+		return errors.New("acknowledgement carrying data")
+	}
+	if onesSum(b) != 0xffff {
+		return errors.New("bad segment checksum")
+	}
+	*s = Segment{
+		Conn:      binary.BigEndian.Uint16(b[0:]),
+		Ack:       b[2]&segmentFlagAck != 0,
+		Selective: b[2]&segmentFlagSelective != 0,
+		Seq:       binary.BigEndian.Uint32(b[4:]),
+		Next:      binary.BigEndian.Uint32(b[8:]),
+		Data:      append([]byte(nil), b[segmentHeaderBytes:]...),
+	}
+	return nil
+}
+
+type SegmentEventCb func(id int, from netip.Addr, s *Segment)
+
+// Connection sends a stream of segments from a device to another reliably.
+// The segments are numbered in order, at most Window of them go
+// unacknowledged at once, and each is sent again when its acknowledgement
+// does not arrive within the retransmission timeout.
+type Connection struct {
+	sim    *Simulation
+	device *NetworkDevice
+	id     uint16
+
+	Dst     netip.Addr
+	ARQ     ARQ
+	Window  int
+	Timeout int // Initial retransmission timeout, used until a round trip has been measured
+
+	segments [][]byte    // Data of every segment written, dropped once delivered
+	flight   []*inFlight // Segments sent and not yet delivered, by number less base
+	base     uint32      // Oldest segment not yet delivered
+	timer    int         // Tick the timer of the oldest segment started at, under Go-Back-N
+	srtt     float64     // Smoothed round trip time
+	rttvar   float64     // Variation of the round trip time
+	rto      int         // Retransmission timeout
+	start    int
+	last     int // Tick of the last delivery
+	stats    TransportStats
+}
+
+type inFlight struct {
+	sentAt int
+	sends  int
+	acked  bool // Acknowledged selectively, ahead of base
+}
+
+// TransportStats summarises the progress of a connection
+type TransportStats struct {
+	Segments        int // Segments written
+	Sent            int // Transmissions, counting every retransmission
+	Retransmissions int
+	Timeouts        int // Expiries of the retransmission timer
+	Delivered       int // Segments acknowledged, and so delivered to the receiver in order
+	Bytes           int // Data delivered
+	Ticks           int // Ticks from opening the connection to its last delivery, or until now if segments are outstanding
+}
+
+// Goodput is the number of data bytes delivered per tick
+func (s TransportStats) Goodput() float64 {
+	if s.Ticks == 0 {
+		return 0
+	}
+	return float64(s.Bytes) / float64(s.Ticks)
+}
+
+// Delivery is the fraction of the segments written that were delivered
+func (s TransportStats) Delivery() float64 {
+	if s.Segments == 0 {
+		return 0
+	}
+	return float64(s.Delivered) / float64(s.Segments)
+}
+
+// RetransmissionRate is the fraction of transmissions that were retransmissions
+func (s TransportStats) RetransmissionRate() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Retransmissions) / float64(s.Sent)
+}
+
+func (s TransportStats) String() string {
+	return fmt.Sprintf("%v/%v segments delivered, %v sent, %v retransmitted, goodput %.3f bytes/tick",
+		s.Delivered, s.Segments, s.Sent, s.Retransmissions, s.Goodput())
+}
+
+// MakeConnection opens a connection from the device to dst, which sends the
+// segments written to it in a window of the given size. Until a round trip
+// has been measured, the timeout leaves room for ARP to resolve dst.
+func MakeConnection(d *NetworkDevice, dst netip.Addr, arq ARQ, window int) (*Connection, error) {
+	if err := d.route(dst); err != nil {
+		return nil, err
+	}
+	if dst == LimitedBroadcast || dst == subnetBroadcast(d.ip.addr) {
+		return nil, fmt.Errorf("connection to broadcast address %v", dst)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("connection window must be positive")
+	}
+	c := &Connection{
+		sim:     d.sim,
+		device:  d,
+		id:      uint16(len(d.ip.conns) + 1),
+		Dst:     dst,
+		ARQ:     arq,
+		Window:  window,
+		Timeout: arpRequestLimit * d.sim.config.ARPRetryTicks,
+		start:   d.sim.ticks,
+		last:    d.sim.ticks,
+	}
+	d.ip.conns = append(d.ip.conns, c)
+	d.sim.register(c)
+	return c, nil
+}
+
+// Connection returns the connection the device opened last, nil if none
+func (d *NetworkDevice) Connection() *Connection {
+	if len(d.ip.conns) == 0 {
+		return nil
+	}
+	return d.ip.conns[len(d.ip.conns)-1]
+}
+
+// Send writes a segment of data to the connection, to be sent once the window allows
+func (c *Connection) Send(data []byte) error {
+	if len(data) > MaxSegmentBytes {
+		return fmt.Errorf("segment of %v bytes exceeds %v", len(data), MaxSegmentBytes)
+	}
+	c.segments = append(c.segments, append([]byte(nil), data...))
+	c.stats.Segments++
+	return nil
+}
+
+// Done reports whether every segment written has been delivered
+func (c *Connection) Done() bool { return int(c.base) == len(c.segments) }
+
+func (c *Connection) Stats() TransportStats {
+	s := c.stats
+	s.Ticks = c.sim.ticks - c.start
+	if c.Done() {
+		s.Ticks = c.last - c.start
+	}
+	return s
+}
+
+func (c *Connection) TickFalling() bool { return false }
+func (c *Connection) Tick() {
+	if c.rto == 0 {
+		c.rto = c.Timeout
+	}
+	t := c.sim.ticks
+	switch c.ARQ {
+	case ARQGoBackN:
+		if len(c.flight) > 0 && t-c.timer >= c.rto {
+			c.timer = t
+			for i := range c.flight {
+				c.transmit(i)
+			}
+			c.timeout()
+		}
+	case ARQSelectiveRepeat:
+		expired := false
+		for i, f := range c.flight {
+			if !f.acked && t-f.sentAt >= c.rto {
+				expired = true
+				c.transmit(i)
+			}
+		}
+		// The timeout backs off once however many segments it resends
+		if expired {
+			c.timeout()
+		}
+	}
+
+	for len(c.flight) < c.Window && int(c.base)+len(c.flight) < len(c.segments) {
+		if len(c.flight) == 0 {
+			c.timer = t
+		}
+		c.flight = append(c.flight, &inFlight{})
+		c.transmit(len(c.flight) - 1)
+	}
+}
+
+// timeout backs the retransmission timeout off
+func (c *Connection) timeout() {
+	c.stats.Timeouts++
+	c.rto = min(2*c.rto, maxTimeoutBackoff*c.Timeout)
+}
+
+// transmit sends the i-th segment in flight, for the first time or again
+func (c *Connection) transmit(i int) {
+	f := c.flight[i]
+	if f.sends > 0 {
+		c.stats.Retransmissions++
+	}
+	f.sends++
+	f.sentAt = c.sim.ticks
+	c.stats.Sent++
+	seq := c.base + uint32(i)
+	b, _ := (&Segment{Conn: c.id, Selective: c.ARQ == ARQSelectiveRepeat, Seq: seq, Data: c.segments[seq]}).MarshalBinary()
+	// A device that lost its address sends nothing, and the segment times out
+	c.device.SendIP(c.Dst, IPProtocolTransport, b)
+}
+
+// onAck marks the segments an acknowledgement covers, and slides the window
+// past those delivered
+func (c *Connection) onAck(from netip.Addr, s *Segment) {
+	if from != c.Dst {
+		return
+	}
+	if s.Selective && s.Seq >= c.base && s.Seq < c.base+uint32(len(c.flight)) {
+		if f := c.flight[s.Seq-c.base]; !f.acked {
+			c.measure(f)
+			f.acked = true
+		}
+	}
+	if s.Next <= c.base || s.Next > c.base+uint32(len(c.flight)) {
+		return
+	}
+	if f := c.flight[s.Next-1-c.base]; !f.acked {
+		c.measure(f)
+	}
+	for c.base < s.Next {
+		c.stats.Delivered++
+		c.stats.Bytes += len(c.segments[c.base])
+		c.segments[c.base] = nil
+		c.flight = c.flight[1:]
+		c.base++
+	}
+	c.timer = c.sim.ticks
+	c.last = c.sim.ticks
+}
+
+// measure updates the retransmission timeout with the round trip of a
+// segment, as in RFC 6298. Segments sent more than once are skipped, as it
+// is unknown which of the transmissions was acknowledged.
+func (c *Connection) measure(f *inFlight) {
+	if f.sends > 1 {
+		return
+	}
+	rtt := float64(c.sim.ticks - f.sentAt)
+	if c.srtt == 0 {
+		c.srtt, c.rttvar = rtt, rtt/2
+	} else {
+		c.rttvar = 0.75*c.rttvar + 0.25*math.Abs(c.srtt-rtt)
+		c.srtt = 0.875*c.srtt + 0.125*rtt
+	}
+	c.rto = int(c.srtt + max(float64(c.sim.config.FrameTicks), 4*c.rttvar))
+}
+
+// receiver reassembles the segments of a connection from another device
+type receiver struct {
+	next     uint32            // Number of the next segment to deliver
+	buffered map[uint32][]byte // Segments that arrived ahead of next, under selective repeat
+}
+
+type connKey struct {
+	src  netip.Addr
+	conn uint16
+}
+
+// handleSegment delivers the data segments sent to the device in order and
+// acknowledges them, and passes acknowledgements on to the connection they
+// belong to. Under Go-Back-N, segments that arrive ahead of the next one
+// expected are discarded, as the sender will send them again.
+func (d *NetworkDevice) handleSegment(p *IPv4Packet) {
+	var s Segment
+	if s.UnmarshalBinary(p.Payload) != nil {
+		return
+	}
+	if s.Ack {
+		if s.Conn > 0 && int(s.Conn) <= len(d.ip.conns) {
+			d.ip.conns[s.Conn-1].onAck(p.Src, &s)
+		}
+		return
+	}
+
+	key := connKey{src: p.Src, conn: s.Conn}
+	r, ok := d.ip.receivers[key]
+	if !ok {
+		r = &receiver{buffered: make(map[uint32][]byte)}
+		d.ip.receivers[key] = r
+	}
+	switch {
+	case s.Seq == r.next:
+		d.deliver(p.Src, r, s.Data)
+		for data, ok := r.buffered[r.next]; ok; data, ok = r.buffered[r.next] {
+			delete(r.buffered, r.next)
+			d.deliver(p.Src, r, data)
+		}
+	case s.Seq > r.next && s.Selective && s.Seq-r.next <= maxSegmentReceiveAhead:
+		r.buffered[s.Seq] = s.Data
+	}
+	b, _ := (&Segment{Conn: s.Conn, Ack: true, Selective: s.Selective, Seq: s.Seq, Next: r.next}).MarshalBinary()
+	d.SendIP(p.Src, IPProtocolTransport, b)
+}
+
+// deliver passes the next segment of a connection on to the device
+func (d *NetworkDevice) deliver(src netip.Addr, r *receiver, data []byte) {
+	d.sim.onDeviceDeliverSegment(d.id, src, &Segment{Seq: r.next, Data: data})
+	r.next++
+}
@@ -0,0 +1,71 @@
+package ethersim_test
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// TestConnection sends a stream through a switch to a transceiver that
+// keeps falling silent, under each ARQ, and checks that every segment is
+// delivered once and in order
+func TestConnection(t *testing.T) {
+	for _, arq := range []ethersim.ARQ{ethersim.ARQGoBackN, ethersim.ARQSelectiveRepeat} {
+		t.Run(arq.String(), func(t *testing.T) {
+			s := ethersim.MakeSeededSimulation(1)
+			build(t, s, ethersim.SwitchedTopology(3, 4))
+			if err := s.AssignIPs(netip.MustParsePrefix("10.0.0.0/24")); err != nil {
+				t.Fatal(err)
+			}
+			for start := 1000; start < 100000; start += 1500 {
+				s.Nodes()[2].InjectFault(ethersim.Fault{Kind: ethersim.FaultSilent, Start: start, End: start + 400})
+			}
+
+			d := s.Devices()
+			c, err := ethersim.MakeConnection(d[0], d[2].IP().Addr(), arq, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const n = 50
+			for i := range n {
+				if err := c.Send([]byte(fmt.Sprintf("segment %v", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var delivered []string
+			s.SetDeviceDeliverSegmentCb(func(id int, from netip.Addr, seg *ethersim.Segment) {
+				if id != d[2].Id() || from != d[0].IP().Addr() {
+					t.Errorf("D%v delivered a segment from %v", id, from)
+				}
+				if int(seg.Seq) != len(delivered) {
+					t.Errorf("segment %v delivered after %v others", seg.Seq, len(delivered))
+				}
+				delivered = append(delivered, string(seg.Data))
+			})
+			for !c.Done() && s.Ticks() < 100000 {
+				s.Tick()
+			}
+
+			st := c.Stats()
+			if !c.Done() {
+				t.Fatalf("transfer did not finish: %v", st)
+			}
+			for i, data := range delivered {
+				if want := fmt.Sprintf("segment %v", i); data != want {
+					t.Fatalf("segment %v is %q, not %q", i, data, want)
+				}
+			}
+			if len(delivered) != n || st.Delivered != n || st.Segments != n {
+				t.Errorf("%v segments delivered, stats %v", len(delivered), st)
+			}
+			if st.Retransmissions == 0 || st.Timeouts == 0 {
+				t.Errorf("nothing was lost: %v", st)
+			}
+			if st.Sent != st.Delivered+st.Retransmissions {
+				t.Errorf("%v sent is not %v delivered and %v retransmitted", st.Sent, st.Delivered, st.Retransmissions)
+			}
+		})
+	}
+}
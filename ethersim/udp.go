@@ -0,0 +1,292 @@
+package ethersim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	udpHeaderBytes     = 8
+	udpEphemeralPorts  = 49152 // First port handed out to connections that ask for port 0
+	udpReceiveDatagram = 64    // Datagrams a connection holds before it drops new ones
+)
+
+// MaxDatagramBytes is the most data a UDP datagram carries in one frame
+const MaxDatagramBytes = MaxPayloadBytes - ipv4HeaderBytes - udpHeaderBytes
+
+// UDPDatagram is a UDP datagram, carried in an IPv4 packet. Datagrams are
+// sent without a checksum, which IPv4 allows, as frames already carry one.
+type UDPDatagram struct {
+	SrcPort uint16
+	DstPort uint16
+	Data    []byte
+}
+
+func (u *UDPDatagram) String() string {
+	return fmt.Sprintf("UDP %v > %v len=%v", u.SrcPort, u.DstPort, len(u.Data))
+}
+
+func (u *UDPDatagram) MarshalBinary() ([]byte, error) {
+	if len(u.Data) > MaxDatagramBytes {
+		return nil, fmt.Errorf("datagram of %v bytes exceeds %v", len(u.Data), MaxDatagramBytes)
+	}
+	b := make([]byte, udpHeaderBytes, udpHeaderBytes+len(u.Data))
+	binary.BigEndian.PutUint16(b[0:], u.SrcPort)
+	binary.BigEndian.PutUint16(b[2:], u.DstPort)
+	binary.BigEndian.PutUint16(b[4:], uint16(udpHeaderBytes+len(u.Data)))
+	return append(b, u.Data...), nil
+}
+
+// UnmarshalBinary decodes a datagram, ignoring any bytes past its length
+// and its checksum
+func (u *UDPDatagram) UnmarshalBinary(b []byte) error {
+	if len(b) < udpHeaderBytes {
+		return fmt.Errorf("UDP datagram of %v bytes", len(b))
+	}
+	length := int(binary.BigEndian.Uint16(b[4:]))
+	if length < udpHeaderBytes || length > len(b) {
+		return fmt.Errorf("UDP length %v in %v bytes", length, len(b))
+	}
+	*u = UDPDatagram{
+		SrcPort: binary.BigEndian.Uint16(b[0:]),
+		DstPort: binary.BigEndian.Uint16(b[2:]),
+		Data:    append([]byte(nil), b[udpHeaderBytes:length]...),
+	}
+	return nil
+}
+
+// Addr is the address of a UDP socket on a simulated device
+type Addr struct {
+	IP   netip.Addr
+	Port uint16
+}
+
+func (a *Addr) Network() string { return "ethersim" }
+func (a *Addr) String() string  { return netip.AddrPortFrom(a.IP, a.Port).String() }
+
+// ParseAddr reads an address written as an IPv4 address and a port, such as 10.0.0.1:7
+func ParseAddr(s string) (*Addr, error) {
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	if !ap.Addr().Is4() {
+		return nil, fmt.Errorf("address %v is not IPv4", s)
+	}
+	return &Addr{IP: ap.Addr(), Port: ap.Port()}, nil
+}
+
+// toAddr converts an *Addr or an IPv4 *net.UDPAddr to an *Addr
+func toAddr(addr net.Addr) (*Addr, bool) {
+	switch a := addr.(type) {
+	case *Addr:
+		return a, a != nil && a.IP.Is4()
+	case *net.UDPAddr:
+		if a == nil {
+			return nil, false
+		}
+		ap := a.AddrPort()
+		return &Addr{IP: ap.Addr().Unmap(), Port: ap.Port()}, ap.Addr().Unmap().Is4()
+	}
+	return nil, false
+}
+
+// PacketConn is a UDP socket on a simulated device, as a net.PacketConn.
+// Its methods may be called from any goroutine while another ticks the
+// simulation: datagrams written are sent on the next tick, and reads block
+// until a tick delivers a datagram. Deadlines are compared with the virtual
+// clock of the simulation, Simulation.Now, so they only pass as it ticks.
+type PacketConn struct {
+	device *NetworkDevice
+	local  *Addr
+
+	mu            sync.Mutex
+	wake          *sync.Cond // Signalled when a datagram arrives, a tick passes or the connection closes
+	now           time.Time  // Virtual time of the last tick
+	received      []packet
+	sending       []packet
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closed        bool
+}
+
+// packet is a datagram with the address of its sender or destination
+type packet struct {
+	addr *Addr
+	data []byte
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+// ListenPacket opens a UDP socket on the device, on an unused port of the
+// device if port is 0. Like every other method of the simulation, it must be
+// called from the goroutine that ticks it.
+func (d *NetworkDevice) ListenPacket(port uint16) (*PacketConn, error) {
+	if !d.ip.addr.IsValid() {
+		return nil, ErrNoAddress
+	}
+	if d.ip.ports == nil {
+		d.ip.ports = make(map[uint16]*PacketConn)
+	}
+	if port == 0 {
+		for port = udpEphemeralPorts; d.bound(port); port++ {
+			if port == 0xffff {
+				return nil, fmt.Errorf("device has no free port")
+			}
+		}
+	} else if d.bound(port) {
+		return nil, fmt.Errorf("port %v of %v is in use", port, d.ip.addr.Addr())
+	}
+	c := &PacketConn{device: d, local: &Addr{IP: d.ip.addr.Addr(), Port: port}, now: d.sim.Now()}
+	c.wake = sync.NewCond(&c.mu)
+	d.ip.ports[port] = c
+	d.sim.register(c)
+	return c, nil
+}
+
+// bound reports whether a connection that is still open listens on the port
+func (d *NetworkDevice) bound(port uint16) bool {
+	c, ok := d.ip.ports[port]
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.closed
+}
+
+func (c *PacketConn) TickFalling() bool { return false }
+func (c *PacketConn) Tick() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.device
+	if c.closed {
+		if d.ip.ports[c.local.Port] == c {
+			delete(d.ip.ports, c.local.Port)
+		}
+		d.sim.unregister(c)
+		return
+	}
+	for _, p := range c.sending {
+		b, _ := (&UDPDatagram{SrcPort: c.local.Port, DstPort: p.addr.Port, Data: p.data}).MarshalBinary()
+		// Datagrams that cannot be routed are lost, as a device that has lost
+		// its address would lose them
+		d.SendIP(p.addr.IP, IPProtocolUDP, b)
+	}
+	c.sending = nil
+	c.now = d.sim.Now()
+	c.wake.Broadcast()
+}
+
+// deliver passes a datagram the device received on to a reader
+func (c *PacketConn) deliver(from *Addr, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.received) >= udpReceiveDatagram {
+		return
+	}
+	c.received = append(c.received, packet{addr: from, data: data})
+	c.wake.Broadcast()
+}
+
+// ReadFrom waits for a datagram and copies it into p, dropping whatever does not fit
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.received) == 0 {
+		if c.closed {
+			return 0, nil, c.opError("read", nil, net.ErrClosed)
+		}
+		if passed(c.readDeadline, c.now) {
+			return 0, nil, c.opError("read", nil, os.ErrDeadlineExceeded)
+		}
+		c.wake.Wait()
+	}
+	pkt := c.received[0]
+	c.received = c.received[1:]
+	return copy(p, pkt.data), pkt.addr, nil
+}
+
+// WriteTo sends p to addr, an *Addr or an IPv4 *net.UDPAddr, on the next tick. It does not wait for
+// the datagram to be sent, and the datagram may be lost on the way.
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	to, ok := toAddr(addr)
+	if !ok {
+		return 0, c.opError("write", addr, fmt.Errorf("address %v is not an IPv4 address and port", addr))
+	}
+	if len(p) > MaxDatagramBytes {
+		return 0, c.opError("write", addr, fmt.Errorf("datagram of %v bytes exceeds %v", len(p), MaxDatagramBytes))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, c.opError("write", addr, net.ErrClosed)
+	}
+	if passed(c.writeDeadline, c.now) {
+		return 0, c.opError("write", addr, os.ErrDeadlineExceeded)
+	}
+	c.sending = append(c.sending, packet{addr: to, data: append([]byte(nil), p...)})
+	return len(p), nil
+}
+
+// Close stops the connection, and waiting reads return. The port is freed
+// on the next tick.
+func (c *PacketConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("close", nil, net.ErrClosed)
+	}
+	c.closed = true
+	c.wake.Broadcast()
+	return nil
+}
+
+func (c *PacketConn) LocalAddr() net.Addr { return c.local }
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.wake.Broadcast()
+	return nil
+}
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.wake.Broadcast()
+	return nil
+}
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *PacketConn) opError(op string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: c.local.Network(), Source: c.local, Addr: addr, Err: err}
+}
+
+// passed reports whether a deadline, zero if there is none, has passed
+func passed(deadline time.Time, now time.Time) bool {
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// handleUDP passes a datagram sent to the device on to the connection
+// listening on its port, if any
+func (d *NetworkDevice) handleUDP(p *IPv4Packet) {
+	var u UDPDatagram
+	if u.UnmarshalBinary(p.Payload) != nil {
+		return
+	}
+	if c, ok := d.ip.ports[u.DstPort]; ok {
+		c.deliver(&Addr{IP: p.Src, Port: u.SrcPort}, u.Data)
+	}
+}
@@ -0,0 +1,173 @@
+package ethersim_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/ethersim/ethersim"
+)
+
+// udpPair addresses the two devices of a switched network
+func udpPair(t *testing.T) (*ethersim.Simulation, *ethersim.NetworkDevice, *ethersim.NetworkDevice) {
+	t.Helper()
+	s := ethersim.MakeSeededSimulation(1)
+	build(t, s, ethersim.SwitchedTopology(2, 4))
+	if err := s.AssignIPs(netip.MustParsePrefix("10.0.0.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	d := s.Devices()
+	return s, d[0], d[1]
+}
+
+// echo answers every datagram on conn with a copy until it closes
+func echo(conn net.PacketConn) {
+	buf := make([]byte, ethersim.MaxDatagramBytes)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(buf[:n], from)
+	}
+}
+
+// TestPacketConn exchanges datagrams between two devices while another
+// goroutine ticks the simulation. Run it with -race.
+func TestPacketConn(t *testing.T) {
+	s, a, b := udpPair(t)
+	client, err := a.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := b.ListenPacket(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go echo(server)
+
+	stop := make(chan struct{})
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.Tick()
+			}
+		}
+	}()
+
+	buf := make([]byte, ethersim.MaxDatagramBytes)
+	for i := range 20 {
+		msg := fmt.Sprintf("datagram %v", i)
+		if _, err := client.WriteTo([]byte(msg), server.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		n, from, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != msg || from.String() != server.LocalAddr().String() {
+			t.Fatalf("read %q from %v, not %q from %v", buf[:n], from, msg, server.LocalAddr())
+		}
+	}
+	close(stop)
+	<-ticked
+	client.Close()
+	server.Close()
+}
+
+// TestPacketConnDeadline checks that a read deadline passes with the
+// virtual clock of the simulation and not the wall clock
+func TestPacketConnDeadline(t *testing.T) {
+	s, a, _ := udpPair(t)
+	conn, err := a.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without physical units a tick lasts a microsecond
+	const wait = 1000
+	deadline := s.Ticks() + wait
+	conn.SetReadDeadline(s.Now().Add(wait * time.Microsecond))
+
+	done := make(chan error)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	for s.Ticks() <= deadline {
+		select {
+		case err := <-done:
+			t.Fatalf("read returned %v after %v of %v ticks", err, s.Ticks()-deadline+wait, wait)
+		default:
+		}
+		s.Tick()
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("read returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read did not return once the deadline passed")
+	}
+}
+
+// TestPacketConnClose checks that closing a connection wakes a blocked
+// reader, and that ports given out for port 0 are free ones
+func TestPacketConnClose(t *testing.T) {
+	s, a, _ := udpPair(t)
+	first, err := a.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := a.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, p2 := first.LocalAddr().(*ethersim.Addr).Port, second.LocalAddr().(*ethersim.Addr).Port
+	if p1 < 49152 || p2 < 49152 || p1 == p2 {
+		t.Fatalf("ephemeral ports %v and %v", p1, p2)
+	}
+	if _, err := a.ListenPacket(p1); err == nil {
+		t.Fatalf("port %v was given out twice", p1)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, _, err := first.ReadFrom(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("read returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close did not wake the reader")
+	}
+
+	// The port is free again once a tick has passed
+	s.Tick()
+	third, err := a.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := third.LocalAddr().(*ethersim.Addr).Port; p != p1 {
+		t.Errorf("port %v was given out instead of the freed port %v", p, p1)
+	}
+	second.Close()
+	third.Close()
+}
@@ -0,0 +1,219 @@
+package ethersim
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Limits of the 5-4-3 rule for coaxial Ethernet: between any two stations
+// there may be at most 5 segments joined by 4 repeaters, of which at most 3
+// segments have stations on them
+var maxSegments int = 5
+var maxRepeaters int = 4
+var maxPopulatedSegments int = 3
+
+// ValidateTopology warns about paths between stations that break the 5-4-3
+// rule, about round trips that outlast the slot time so that collisions are
+// detected late, about frames shorter than the slot time so that a
+// transmitter could finish before hearing a collision, and about loops. Links meeting at a transceiver
+// form a single segment, links meeting at a repeater separate segments.
+func (s *Simulation) ValidateTopology() []error {
+	errs := make([]error, 0)
+	seg := s.segments()
+
+	// Segments joined by each repeater
+	adj := make(map[int][]int)
+	for _, r := range s.repeaters {
+		for _, p1 := range r.ports {
+			for _, p2 := range r.ports {
+				if seg[p1] != seg[p2] {
+					adj[seg[p1]] = append(adj[seg[p1]], seg[p2])
+				}
+			}
+		}
+	}
+
+	populated := make(map[int]bool)
+	stations := make(map[int]*NetworkDevice)
+	for _, n := range s.nodes {
+		if n.deviceEdge == nil || len(n.edges) == 0 {
+			continue
+		}
+		sg := seg[n.edges[0]]
+		populated[sg] = true
+		if _, ok := stations[sg]; !ok {
+			stations[sg] = n.deviceEdge.n2.(*NetworkDevice)
+		}
+	}
+
+	worst := [3]struct {
+		n      int
+		d1, d2 *NetworkDevice
+	}{}
+	order := slices.Sorted(maps.Keys(stations))
+	for _, from := range order {
+		d1 := stations[from]
+		// Breadth first search over segments
+		parent := map[int]int{from: -1}
+		queue := []int{from}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range adj[cur] {
+				if _, seen := parent[next]; !seen {
+					parent[next] = cur
+					queue = append(queue, next)
+				}
+			}
+		}
+
+		for _, to := range order {
+			d2 := stations[to]
+			if _, ok := parent[to]; !ok || d1.id >= d2.id {
+				continue
+			}
+			segments, full := 0, 0
+			for sg := to; sg >= 0; sg = parent[sg] {
+				segments++
+				if populated[sg] {
+					full++
+				}
+			}
+			for i, n := range []int{segments, segments - 1, full} {
+				if n > worst[i].n {
+					worst[i].n, worst[i].d1, worst[i].d2 = n, d1, d2
+				}
+			}
+		}
+	}
+
+	for i, limit := range []struct {
+		max  int
+		what string
+	}{
+		{maxSegments, "segments"},
+		{maxRepeaters, "repeaters"},
+		{maxPopulatedSegments, "populated segments"},
+	} {
+		if w := worst[i]; w.n > limit.max {
+			errs = append(errs, fmt.Errorf("D%v and D%v are joined by %v %v, at most %v are allowed", w.d1.id, w.d2.id, w.n, limit.what, limit.max))
+		}
+	}
+
+	errs = append(errs, s.loops()...)
+
+	if rt := s.RoundTripDelay(); rt >= s.config.SlotTicks {
+		errs = append(errs, fmt.Errorf("round trip of %v ticks outlasts the %v tick slot time, collisions may be detected late", rt, s.config.SlotTicks))
+	}
+	if s.config.FrameTicks < s.config.SlotTicks {
+		errs = append(errs, fmt.Errorf("frames of %v ticks are shorter than the %v tick slot time, collisions may go undetected", s.config.FrameTicks, s.config.SlotTicks))
+	}
+	return errs
+}
+
+// segments numbers the links of the simulation by the segment they belong to
+func (s *Simulation) segments() map[link]int {
+	seg := make(map[link]int)
+	next := 0
+	var visit func(l link, id int)
+	visit = func(l link, id int) {
+		if _, ok := seg[l]; ok {
+			return
+		}
+		seg[l] = id
+		for _, end := range l.ends() {
+			if n, ok := end.(*NetworkNode); ok {
+				for _, nl := range n.edges {
+					visit(nl, id)
+				}
+			}
+		}
+	}
+
+	for _, j := range s.junctions() {
+		for _, l := range j.links() {
+			if _, ok := seg[l]; !ok {
+				visit(l, next)
+				next++
+			}
+		}
+	}
+	return seg
+}
+
+func (s *Simulation) junctions() []junction {
+	js := make([]junction, 0, len(s.nodes)+len(s.repeaters)+len(s.switches))
+	for _, n := range s.nodes {
+		js = append(js, n)
+	}
+	for _, r := range s.repeaters {
+		js = append(js, r)
+	}
+	for _, sw := range s.switches {
+		js = append(js, sw)
+	}
+	return js
+}
+
+// loops warns about links that close a loop. Within a collision domain every
+// signal would circulate forever, which is why the ether must be a tree.
+// Through switches only flooded frames circulate, unless the spanning tree
+// protocol blocks a port of the loop.
+func (s *Simulation) loops() []error {
+	links := make([]link, 0, len(s.edges)+len(s.buses))
+	for _, e := range s.edges {
+		_, ok1 := e.n1.(junction)
+		_, ok2 := e.n2.(junction)
+		if ok1 && ok2 {
+			links = append(links, e)
+		}
+	}
+	for _, b := range s.buses {
+		links = append(links, b)
+	}
+
+	// Union-find over links and the junctions at their ends
+	parent := make(map[Network]Network)
+	var find func(n Network) Network
+	find = func(n Network) Network {
+		if p, ok := parent[n]; ok && p != n {
+			parent[n] = find(p)
+			return parent[n]
+		}
+		parent[n] = n
+		return n
+	}
+
+	errs := make([]error, 0)
+	// Collision domains are joined up first, then switches join them
+	for _, bridged := range []bool{false, true} {
+		for _, l := range links {
+			if slices.ContainsFunc(l.ends(), isSwitch) != bridged {
+				continue
+			}
+			for _, end := range l.ends() {
+				if find(l) != find(end) {
+					parent[find(l)] = find(end)
+					continue
+				}
+				name := fmt.Sprintf("E%v", l.Id())
+				if _, ok := l.(*BusSegment); ok {
+					name = fmt.Sprintf("B%v", l.Id())
+				}
+				if !bridged {
+					errs = append(errs, fmt.Errorf("%v closes a loop within a collision domain, signals on it circulate forever", name))
+				} else if !s.stp {
+					errs = append(errs, fmt.Errorf("%v closes a loop between switches, flooded frames circulate forever without the spanning tree protocol", name))
+				}
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func isSwitch(n Network) bool {
+	_, ok := n.(*Switch)
+	return ok
+}
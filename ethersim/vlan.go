@@ -0,0 +1,187 @@
+package ethersim
+
+import "fmt"
+
+// VLAN frames belong to when they arrive untagged on a port with no other configuration
+var defaultVLAN int = 1
+
+// Largest VLAN identifier and priority that fit in an IEEE 802.1Q tag
+var maxVLAN int = 4094
+var maxPriority int = 7
+
+// VLANTag is an IEEE 802.1Q tag. A frame with ID 0 belongs to no VLAN, and
+// is untagged unless it carries a priority or DEI, as a priority-tagged frame.
+type VLANTag struct {
+	ID       int  `json:"id"`
+	Priority int  `json:"priority,omitempty"` // 0 to 7, higher is served first by switches
+	DEI      bool `json:"dei,omitempty"`      // Drop eligible, carried but not acted on
+}
+
+func (t VLANTag) Tagged() bool { return t.ID > 0 }
+
+// header reports whether a frame with the tag carries an 802.1Q header
+func (t VLANTag) header() bool { return t != VLANTag{} }
+
+func (t VLANTag) String() string {
+	if !t.header() {
+		return "untagged"
+	}
+	dei := ""
+	if t.DEI {
+		dei = ", drop eligible"
+	}
+	if !t.Tagged() {
+		return fmt.Sprintf("priority tagged (priority %v%v)", t.Priority, dei)
+	}
+	return fmt.Sprintf("VLAN %v (priority %v%v)", t.ID, t.Priority, dei)
+}
+
+// valid reports whether the tag fits in an 802.1Q header
+func (t VLANTag) valid() bool {
+	return t.ID >= 0 && t.ID <= maxVLAN && t.Priority >= 0 && t.Priority <= maxPriority
+}
+
+// Tagged is implemented by messages whose header carries a VLAN tag
+type Tagged interface {
+	VLAN() VLANTag
+	SetVLAN(t VLANTag)
+}
+
+// VLANOf returns the tag of msg, or an untagged tag if it cannot carry one
+func VLANOf(msg NetworkMsg) VLANTag {
+	if t, ok := msg.(Tagged); ok {
+		return t.VLAN()
+	}
+	return VLANTag{}
+}
+
+// withVLAN returns a copy of msg carrying tag t, or msg itself if it cannot carry one
+func withVLAN(msg NetworkMsg, t VLANTag) NetworkMsg {
+	if _, ok := msg.(Tagged); !ok {
+		return msg
+	}
+	msg = msg.Copy()
+	msg.(Tagged).SetVLAN(t)
+	return msg
+}
+
+// SetVLAN makes the device a member of a VLAN. It tags the frames it sends
+// that are not tagged yet and ignores frames tagged for other VLANs. A tag
+// with ID 0 leaves the device untagged.
+func (d *NetworkDevice) SetVLAN(t VLANTag) error {
+	if !t.valid() {
+		return fmt.Errorf("invalid VLAN tag %+v", t)
+	}
+	d.vlan = t
+	return nil
+}
+func (d *NetworkDevice) VLAN() VLANTag { return d.vlan }
+
+// PortMode is how a switch port treats VLAN tags
+type PortMode int
+
+const (
+	PortTrunk  PortMode = iota // Carries every allowed VLAN, tagged except for the native VLAN
+	PortAccess                 // Carries a single VLAN, untagged
+)
+
+func (m PortMode) String() string {
+	switch m {
+	case PortTrunk:
+		return "Trunk"
+	case PortAccess:
+		return "Access"
+	}
+	return "?"
+}
+
+// PortVLAN is the VLAN configuration of a switch port. A switch only forwards
+// a frame out of the ports that carry the VLAN it arrived in.
+type PortVLAN struct {
+	Mode    PortMode
+	VLAN    int   // VLAN of an access port, native VLAN of a trunk port
+	Allowed []int // VLANs a trunk port carries, all if empty
+}
+
+// SetAccess makes port i carry untagged frames of a single VLAN
+func (sw *Switch) SetAccess(i int, vlan int) error {
+	if i < 0 || i >= len(sw.ports) {
+		return fmt.Errorf("S%v has no port %v", sw.id, i)
+	}
+	if vlan < 1 || vlan > maxVLAN {
+		return fmt.Errorf("invalid VLAN %v", vlan)
+	}
+	sw.ports[i].vlan = PortVLAN{Mode: PortAccess, VLAN: vlan}
+	return nil
+}
+
+// SetTrunk makes port i carry the allowed VLANs, or all of them if none are
+// given, tagging frames of every VLAN but the native one
+func (sw *Switch) SetTrunk(i int, native int, allowed ...int) error {
+	if i < 0 || i >= len(sw.ports) {
+		return fmt.Errorf("S%v has no port %v", sw.id, i)
+	}
+	for _, v := range append([]int{native}, allowed...) {
+		if v < 1 || v > maxVLAN {
+			return fmt.Errorf("invalid VLAN %v", v)
+		}
+	}
+	sw.ports[i].vlan = PortVLAN{Mode: PortTrunk, VLAN: native, Allowed: allowed}
+	return nil
+}
+
+// PortVLAN returns the VLAN configuration of port i
+func (sw *Switch) PortVLAN(i int) PortVLAN { return sw.ports[i].vlan }
+
+// Port returns the index of the port on link l, or -1
+func (sw *Switch) Port(l Network) int {
+	for i, p := range sw.ports {
+		if Network(p.link) == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// carries reports whether the port is a member of a VLAN
+func (c PortVLAN) carries(vlan int) bool {
+	if c.Mode == PortAccess {
+		return c.VLAN == vlan
+	}
+	if len(c.Allowed) == 0 || vlan == c.VLAN {
+		return true
+	}
+	for _, v := range c.Allowed {
+		if v == vlan {
+			return true
+		}
+	}
+	return false
+}
+
+// ingress returns the VLAN a frame arriving on the port belongs to, and
+// whether the port accepts it
+func (c PortVLAN) ingress(msg NetworkMsg) (int, bool) {
+	t := VLANOf(msg)
+	if !t.Tagged() {
+		return c.VLAN, true
+	}
+	return t.ID, c.carries(t.ID)
+}
+
+// egress returns the frame as it leaves the port, tagged unless the port is
+// an access port or the VLAN is the native VLAN of a trunk
+func (c PortVLAN) egress(msg NetworkMsg, vlan int) NetworkMsg {
+	t := VLANOf(msg)
+	if c.Mode == PortAccess || vlan == c.VLAN {
+		if !t.header() {
+			return msg
+		}
+		return withVLAN(msg, VLANTag{})
+	}
+	if t.ID == vlan {
+		return msg
+	}
+	t.ID = vlan
+	return withVLAN(msg, t)
+}
@@ -1 +1,419 @@
 package ethersim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+)
+
+// MAC is a 48-bit IEEE 802 address. Devices are given locally administered
+// addresses that carry their id, which stays the handle the simulation uses.
+type MAC [6]byte
+
+// Broadcast is the address every device receives
+var Broadcast = MAC{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// MACOf returns the address of the device with the given id
+func MACOf(id int) MAC {
+	if id < 0 {
+		return Broadcast
+	}
+	m := MAC{0x02, 0x00}
+	binary.BigEndian.PutUint32(m[2:], uint32(id))
+	return m
+}
+
+// Handle returns the id of the device the address belongs to, or -1 for
+// group addresses and addresses no device of the simulation can have
+func (m MAC) Handle() int {
+	if m.Group() || m[0] != 0x02 || m[1] != 0x00 {
+		return -1
+	}
+	return int(binary.BigEndian.Uint32(m[2:]))
+}
+
+// Group reports whether the address names a group of devices rather than one
+func (m MAC) Group() bool { return m[0]&0x01 != 0 }
+
+func (m MAC) String() string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", m[0], m[1], m[2], m[3], m[4], m[5])
+}
+
+// ParseMAC reads an address written as six colon separated hex bytes
+func ParseMAC(s string) (MAC, error) {
+	hw, err := net.ParseMAC(s)
+	if err != nil || len(hw) != len(MAC{}) {
+		return MAC{}, fmt.Errorf("invalid MAC address %q", s)
+	}
+	return MAC(hw), nil
+}
+
+// broadcast reports whether msg is a frame for every device
+func broadcast(msg NetworkMsg) bool {
+	switch f := msg.(type) {
+	case *Frame:
+		return f.Dst == Broadcast
+	case *XeroxFrame:
+		return f.Dst == XeroxBroadcast
+	}
+	return false
+}
+
+// EtherType names the protocol an Ethernet II frame carries
+type EtherType uint16
+
+const (
+	EtherTypeIPv4 EtherType = 0x0800
+	EtherTypeARP  EtherType = 0x0806
+	EtherTypeVLAN EtherType = 0x8100 // Marks an IEEE 802.1Q tag, not a payload
+)
+
+func (t EtherType) String() string {
+	switch t {
+	case EtherTypeIPv4:
+		return "IPv4"
+	case EtherTypeARP:
+		return "ARP"
+	case EtherTypeVLAN:
+		return "802.1Q"
+	}
+	return fmt.Sprintf("0x%04x", uint16(t))
+}
+
+// Sizes of Ethernet II frames in bytes, counting the FCS but not the preamble
+const (
+	frameHeaderBytes  = 14
+	frameTagBytes     = 4
+	frameFCSBytes     = 4
+	MinFrameBytes     = 64
+	MaxPayloadBytes   = 1500
+	minEtherTypeValue = 0x0600 // Smaller values are IEEE 802.3 lengths
+)
+
+// Frame is an Ethernet II frame. It travels the simulation like any other
+// message, with its addresses standing for the devices they belong to.
+type Frame struct {
+	V         bool
+	Dst       MAC
+	Src       MAC
+	Tag       VLANTag
+	EtherType EtherType
+	Payload   []byte
+	FCS       uint32 // Frame check sequence read by UnmarshalBinary, MarshalBinary computes its own
+	SeqCtl    SequenceControl
+	Last      bool
+}
+
+// MakeFrame returns a frame from the device to dst
+func (d *NetworkDevice) MakeFrame(dst MAC, t EtherType, payload []byte) *Frame {
+	return &Frame{V: true, Dst: dst, Src: d.MAC(), EtherType: t, Payload: payload}
+}
+
+func (f *Frame) Valid() bool  { return f.V }
+func (f *Frame) Invalid()     { f.V = false }
+func (f *Frame) From() int    { return f.Src.Handle() }
+func (f *Frame) IsJam() bool  { return false }
+func (f *Frame) IsLast() bool { return f.Last }
+
+// Value is the payload as text, without the padding of short frames. ARP
+// packets, ICMP echoes, transport segments and UDP datagrams are described,
+// and other IPv4 packets show their own payload.
+func (f *Frame) Value() string {
+	switch f.EtherType {
+	case EtherTypeARP:
+		var p ARPPacket
+		if p.UnmarshalBinary(f.Payload) == nil {
+			return p.String()
+		}
+	case EtherTypeIPv4:
+		var p IPv4Packet
+		if p.UnmarshalBinary(f.Payload) != nil {
+			break
+		}
+		var e ICMPEcho
+		if p.Protocol == IPProtocolICMP && e.UnmarshalBinary(p.Payload) == nil {
+			return e.String()
+		}
+		var seg Segment
+		if p.Protocol == IPProtocolTransport && seg.UnmarshalBinary(p.Payload) == nil {
+			return seg.String()
+		}
+		var u UDPDatagram
+		if p.Protocol == IPProtocolUDP && u.UnmarshalBinary(p.Payload) == nil {
+			return u.String()
+		}
+		return string(p.Payload)
+	}
+	return string(bytes.TrimRight(f.Payload, "\x00"))
+}
+
+func (f *Frame) Dest() int                            { return f.Dst.Handle() }
+func (f *Frame) SetLast()                             { f.Last = true }
+func (f *Frame) VLAN() VLANTag                        { return f.Tag }
+func (f *Frame) SetVLAN(t VLANTag)                    { f.Tag = t }
+func (f *Frame) SequenceControl() SequenceControl     { return f.SeqCtl }
+func (f *Frame) SetSequenceControl(c SequenceControl) { f.SeqCtl = c }
+func (f *Frame) Copy() NetworkMsg {
+	c := *f
+	c.Payload = append([]byte(nil), f.Payload...)
+	return &c
+}
+
+// MarshalBinary encodes the frame as it appears on the wire after the
+// preamble. Short payloads are padded to the minimum frame size, and a frame
+// spoilt by a collision is written with a bad FCS.
+func (f *Frame) MarshalBinary() ([]byte, error) {
+	if len(f.Payload) > MaxPayloadBytes {
+		return nil, fmt.Errorf("payload of %v bytes exceeds %v", len(f.Payload), MaxPayloadBytes)
+	}
+	if f.EtherType < minEtherTypeValue || f.EtherType == EtherTypeVLAN {
+		return nil, fmt.Errorf("invalid EtherType %v", f.EtherType)
+	}
+	if !f.Tag.valid() {
+		return nil, fmt.Errorf("invalid VLAN tag %v", f.Tag)
+	}
+	b := make([]byte, 0, MinFrameBytes+frameTagBytes+len(f.Payload))
+	b = append(b, f.Dst[:]...)
+	b = append(b, f.Src[:]...)
+	if f.Tag.header() {
+		tci := uint16(f.Tag.Priority<<13 | f.Tag.ID)
+		if f.Tag.DEI {
+			tci |= 0x1000
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(EtherTypeVLAN))
+		b = binary.BigEndian.AppendUint16(b, tci)
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(f.EtherType))
+	b = append(b, f.Payload...)
+	for len(b) < MinFrameBytes-frameFCSBytes {
+		b = append(b, 0)
+	}
+	fcs := crc32.ChecksumIEEE(b)
+	if !f.V {
+		fcs = ^fcs
+	}
+	return binary.LittleEndian.AppendUint32(b, fcs), nil
+}
+
+// UnmarshalBinary decodes a frame written by MarshalBinary. The padding of
+// short payloads is kept, as Ethernet II frames do not carry their length.
+// A frame with a bad FCS is decoded but marked invalid and reported as an error.
+func (f *Frame) UnmarshalBinary(b []byte) error {
+	if len(b) < MinFrameBytes {
+		return fmt.Errorf("runt frame of %v bytes", len(b))
+	}
+	body := b[:len(b)-frameFCSBytes]
+	*f = Frame{V: true}
+	copy(f.Dst[:], body[0:6])
+	copy(f.Src[:], body[6:12])
+	t := EtherType(binary.BigEndian.Uint16(body[12:14]))
+	rest := body[frameHeaderBytes:]
+	if t == EtherTypeVLAN {
+		tci := binary.BigEndian.Uint16(rest[0:2])
+		f.Tag = VLANTag{ID: int(tci & 0x0fff), Priority: int(tci >> 13), DEI: tci&0x1000 != 0}
+		t = EtherType(binary.BigEndian.Uint16(rest[2:4]))
+		rest = rest[frameTagBytes:]
+	}
+	if t < minEtherTypeValue {
+		return fmt.Errorf("IEEE 802.3 length field %v instead of an EtherType", uint16(t))
+	}
+	if len(rest) > MaxPayloadBytes {
+		return fmt.Errorf("payload of %v bytes exceeds %v", len(rest), MaxPayloadBytes)
+	}
+	f.EtherType = t
+	f.Payload = append([]byte(nil), rest...)
+	f.FCS = binary.LittleEndian.Uint32(b[len(body):])
+	if crc32.ChecksumIEEE(body) != f.FCS {
+		f.V = false
+		return fmt.Errorf("bad FCS %08x", f.FCS)
+	}
+	return nil
+}
+
+// FrameFormat selects the messages devices exchange in generated traffic
+type FrameFormat int
+
+const (
+	FormatAbstract   FrameFormat = iota // Plain strings between device ids
+	FormatEthernetII                    // IEEE 802.3 frames with an Ethernet II type field
+	FormatXerox                         // Packets of the experimental Ethernet of Metcalfe and Boggs
+)
+
+func (f FrameFormat) String() string {
+	switch f {
+	case FormatAbstract:
+		return "abstract"
+	case FormatEthernetII:
+		return "ethernet2"
+	case FormatXerox:
+		return "xerox"
+	}
+	return "unknown"
+}
+
+// ParseFrameFormat returns the frame format with the given name
+func ParseFrameFormat(name string) (FrameFormat, error) {
+	for f := FormatAbstract; f <= FormatXerox; f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return FormatAbstract, fmt.Errorf("unknown frame format %q", name)
+}
+
+func (f FrameFormat) MarshalText() ([]byte, error) { return []byte(f.String()), nil }
+func (f *FrameFormat) UnmarshalText(text []byte) error {
+	var err error
+	*f, err = ParseFrameFormat(string(text))
+	return err
+}
+
+// PreambleBits is the length of what precedes a frame on the wire for the
+// receiver to synchronise: the single sync bit of the experimental Ethernet,
+// or the 7 preamble bytes and start frame delimiter of IEEE 802.3
+func (f FrameFormat) PreambleBits() int {
+	switch f {
+	case FormatEthernetII:
+		return 64
+	case FormatXerox:
+		return 1
+	}
+	return 0
+}
+
+// message returns a message of the format carrying payload between two devices
+func (f FrameFormat) message(from, to int, payload string) NetworkMsg {
+	switch f {
+	case FormatEthernetII:
+		return &Frame{V: true, Dst: MACOf(to), Src: MACOf(from), EtherType: EtherTypeIPv4, Payload: []byte(payload)}
+	case FormatXerox:
+		return &XeroxFrame{V: true, Dst: XeroxAddressOf(to), Src: XeroxAddressOf(from), Type: XeroxTypePUP, Payload: []byte(payload)}
+	}
+	return &BaseMsg{V: true, Msg: payload, Sender: from, To: to}
+}
+
+// SetFrameFormat chooses the messages generated traffic is made of
+func (s *Simulation) SetFrameFormat(f FrameFormat) { s.format = f }
+func (s *Simulation) FrameFormat() FrameFormat     { return s.format }
+
+// Message returns a message in the simulation's frame format carrying payload
+// from one device to another
+func (s *Simulation) Message(from, to int, payload string) NetworkMsg {
+	return s.format.message(from, to, payload)
+}
+
+// XeroxAddress is an 8-bit station address of the experimental Ethernet.
+// Address 0 reaches every station, so device i has address i+1.
+type XeroxAddress uint8
+
+var XeroxBroadcast XeroxAddress = 0
+
+// XeroxAddressOf returns the address of the device with the given id. Only
+// the first 255 devices can be told apart.
+func XeroxAddressOf(id int) XeroxAddress {
+	if id < 0 {
+		return XeroxBroadcast
+	}
+	return XeroxAddress(id%255 + 1)
+}
+
+// Handle returns the id of the device with the address, or -1 for broadcasts
+func (a XeroxAddress) Handle() int { return int(a) - 1 }
+
+func (a XeroxAddress) String() string { return fmt.Sprintf("%#o", uint8(a)) }
+
+// Type of the PARC Universal Packets the Altos exchanged
+var XeroxTypePUP uint16 = 0x0200
+
+// The paper's packets carry up to about 4000 bits
+const MaxXeroxPayloadBytes = 500
+
+// XeroxFrame is a packet of the 2.94 Mb/s experimental Ethernet: 8-bit
+// destination and source addresses, a 16-bit type, the data and a 16-bit CRC,
+// preceded on the wire by a single sync bit.
+type XeroxFrame struct {
+	V       bool
+	Dst     XeroxAddress
+	Src     XeroxAddress
+	Type    uint16
+	Payload []byte
+	CRC     uint16 // Checksum read by UnmarshalBinary, MarshalBinary computes its own
+	SeqCtl  SequenceControl
+	Last    bool
+}
+
+func (f *XeroxFrame) Valid() bool                          { return f.V }
+func (f *XeroxFrame) Invalid()                             { f.V = false }
+func (f *XeroxFrame) From() int                            { return f.Src.Handle() }
+func (f *XeroxFrame) IsJam() bool                          { return false }
+func (f *XeroxFrame) IsLast() bool                         { return f.Last }
+func (f *XeroxFrame) Value() string                        { return string(f.Payload) }
+func (f *XeroxFrame) Dest() int                            { return f.Dst.Handle() }
+func (f *XeroxFrame) SetLast()                             { f.Last = true }
+func (f *XeroxFrame) SequenceControl() SequenceControl     { return f.SeqCtl }
+func (f *XeroxFrame) SetSequenceControl(c SequenceControl) { f.SeqCtl = c }
+func (f *XeroxFrame) Copy() NetworkMsg {
+	c := *f
+	c.Payload = append([]byte(nil), f.Payload...)
+	return &c
+}
+
+// MarshalBinary encodes the packet as it appears on the wire after the sync
+// bit. A packet spoilt by a collision is written with a bad CRC.
+func (f *XeroxFrame) MarshalBinary() ([]byte, error) {
+	if len(f.Payload) > MaxXeroxPayloadBytes {
+		return nil, fmt.Errorf("payload of %v bytes exceeds %v", len(f.Payload), MaxXeroxPayloadBytes)
+	}
+	b := make([]byte, 0, 6+len(f.Payload))
+	b = append(b, byte(f.Dst), byte(f.Src))
+	b = binary.BigEndian.AppendUint16(b, f.Type)
+	b = append(b, f.Payload...)
+	crc := crc16(b)
+	if !f.V {
+		crc = ^crc
+	}
+	return binary.BigEndian.AppendUint16(b, crc), nil
+}
+
+// UnmarshalBinary decodes a packet written by MarshalBinary. A packet with a
+// bad CRC is decoded but marked invalid and reported as an error.
+func (f *XeroxFrame) UnmarshalBinary(b []byte) error {
+	if len(b) < 6 {
+		return fmt.Errorf("runt packet of %v bytes", len(b))
+	}
+	if len(b)-6 > MaxXeroxPayloadBytes {
+		return fmt.Errorf("payload of %v bytes exceeds %v", len(b)-6, MaxXeroxPayloadBytes)
+	}
+	body := b[:len(b)-2]
+	*f = XeroxFrame{
+		V:       true,
+		Dst:     XeroxAddress(body[0]),
+		Src:     XeroxAddress(body[1]),
+		Type:    binary.BigEndian.Uint16(body[2:4]),
+		Payload: append([]byte(nil), body[4:]...),
+		CRC:     binary.BigEndian.Uint16(b[len(body):]),
+	}
+	if crc16(body) != f.CRC {
+		f.V = false
+		return fmt.Errorf("bad CRC %04x", f.CRC)
+	}
+	return nil
+}
+
+// crc16 is the CRC-16 of the polynomial x^16 + x^15 + x^2 + 1
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}